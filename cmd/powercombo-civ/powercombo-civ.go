@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/bbathe/icom-powercombo-controller/device/icom"
+	"github.com/bbathe/icom-powercombo-controller/device/icom/civ"
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+	"github.com/bbathe/icom-powercombo-controller/util"
+)
+
+const usage = `usage:
+  powercombo-civ capture [-transport serial] -port COM5 [-baud 19200] [-file civ.log]
+      record everything on the CI-V bus without sending anything
+  powercombo-civ print [-address 94] [-raw] [capture files...]
+      pretty-print captures, from stdin if no files are given
+`
+
+func main() {
+	// show file & location, date & time
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	log.SetOutput(os.Stderr)
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "capture":
+		err = runCapture(os.Args[2:])
+	case "print":
+		err = runPrint(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Printf("%+v", err)
+		os.Exit(1)
+	}
+}
+
+// runCapture records the CI-V bus to a rotating capture file (or stdout) until interrupted
+func runCapture(args []string) error {
+	var (
+		kind    string
+		port    string
+		baud    int
+		file    string
+		maxSize int64
+		backups int
+	)
+
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	fs.StringVar(&kind, "transport", transport.KindSerial, "Transport: serial, tcp, pipe or icomlan")
+	fs.StringVar(&port, "port", "", "Port the CI-V bus is connected to")
+	fs.IntVar(&baud, "baud", 19200, "CI-V baud rate")
+	fs.StringVar(&file, "file", "", "Capture file, stdout if empty")
+	fs.Int64Var(&maxSize, "size", 10*1024*1024, "Size the capture file gets to before it's rotated")
+	fs.IntVar(&backups, "backups", 5, "Number of rotated capture files to keep")
+	_ = fs.Parse(args)
+
+	if port == "" {
+		return fmt.Errorf("no port given")
+	}
+
+	var w io.Writer = os.Stdout
+	if file != "" {
+		rf := util.NewRotatingFile(file, maxSize, backups)
+		defer rf.Close()
+		w = rf
+	}
+
+	p, err := transport.Open(kind, port, baud)
+	if err != nil {
+		return err
+	}
+
+	// closing the port stops the sniffer
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		_ = p.Close()
+	}()
+
+	return icom.Sniff(p, icom.NewSniffer(w))
+}
+
+// runPrint pretty-prints capture files, or stdin
+func runPrint(args []string) error {
+	var (
+		address string
+		raw     bool
+	)
+
+	fs := flag.NewFlagSet("print", flag.ExitOnError)
+	fs.StringVar(&address, "address", "", "Only show frames to or from this CI-V address (hex)")
+	fs.BoolVar(&raw, "raw", false, "Show the raw bytes of each frame")
+	_ = fs.Parse(args)
+
+	filter := -1
+	if address != "" {
+		a, err := strconv.ParseUint(address, 16, 8)
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %w", address, err)
+		}
+		filter = int(a)
+	}
+
+	names := addressNames()
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	printCaptures := func(r io.Reader) error {
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			c, err := civ.ParseCapture(s.Text())
+			if err != nil {
+				// keep going, a capture cut off by rotation or a crash has a partial line
+				log.Printf("%+v", err)
+				continue
+			}
+
+			line, ok := format(c, names, filter, raw)
+			if ok {
+				fmt.Fprintln(out, line)
+			}
+		}
+
+		return s.Err()
+	}
+
+	if fs.NArg() == 0 {
+		return printCaptures(os.Stdin)
+	}
+
+	for _, fn := range fs.Args() {
+		f, err := os.Open(fn)
+		if err != nil {
+			return err
+		}
+
+		err = printCaptures(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// format returns c as one line for people to read, false if it's filtered out
+func format(c civ.Capture, names map[byte]string, filter int, raw bool) (string, bool) {
+	dir := "rx"
+	if c.Sent {
+		dir = "tx"
+	}
+
+	s := fmt.Sprintf("%s %s ", c.Time.Local().Format("2006-01-02 15:04:05.000"), dir)
+
+	f, err := civ.Parse(c.Raw)
+	if err != nil {
+		if filter > -1 {
+			return "", false
+		}
+		s += fmt.Sprintf("%-32s %v", "", err)
+	} else {
+		if filter > -1 && int(f.From) != filter && int(f.To) != filter {
+			return "", false
+		}
+		s += fmt.Sprintf("%-14s -> %-14s %s", name(names, f.From), name(names, f.To), civ.Describe(f))
+	}
+
+	if raw {
+		s += fmt.Sprintf("  [% X]", c.Raw)
+	}
+
+	return s, true
+}
+
+// addressNames returns who is usually at each CI-V address
+func addressNames() map[byte]string {
+	names := map[byte]string{
+		civ.ControllerAddress: "controller",
+		civ.BroadcastAddress:  "all",
+	}
+
+	for _, n := range icom.ModelNames() {
+		m, err := icom.LookupModel(n)
+		if err == nil && m.Address != 0 {
+			names[m.Address] = m.Name
+		}
+	}
+
+	return names
+}
+
+// name returns the name of address with the address itself, e.g. IC-7300(94)
+func name(names map[byte]string, address byte) string {
+	if n, ok := names[address]; ok {
+		return fmt.Sprintf("%s(%02X)", n, address)
+	}
+
+	return fmt.Sprintf("%02X", address)
+}
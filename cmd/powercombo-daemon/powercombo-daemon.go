@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/bbathe/icom-powercombo-controller/config"
+	"github.com/bbathe/icom-powercombo-controller/controller"
+	"github.com/bbathe/icom-powercombo-controller/data"
+	"github.com/bbathe/icom-powercombo-controller/status"
+)
+
+var (
+	mutexLast  sync.Mutex
+	lastData   data.Data
+	lastStatus []status.StatusValue
+)
+
+func main() {
+	// show file & location, date & time
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	log.SetOutput(os.Stdout)
+
+	var (
+		configFile string
+		operate    bool
+	)
+
+	// default config file is in the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Printf("%+v", err)
+		os.Exit(1)
+	}
+
+	flag.StringVar(&configFile, "config", filepath.Join(wd, "icom-powercombo-controller")+".yaml", "Configuration file")
+	flag.BoolVar(&operate, "operate", false, "Put the KPA500 in operate after startup")
+	flag.Parse()
+
+	// read config
+	err = config.Read(configFile)
+	if err != nil {
+		log.Printf("%+v", err)
+		os.Exit(1)
+	}
+
+	// log changes from devices
+	hStatus := status.Attach(logStatusChange)
+	hData := data.Attach(logDataChange)
+
+	// catch shutdown requests before starting so we can always leave the kpa500 in standby
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	// start controller
+	ctrl := controller.NewController()
+
+	// startup in standby, unless asked otherwise
+	mode := 0
+	if operate {
+		mode = 1
+	}
+	err = ctrl.SetKPA500Mode(mode)
+	if err != nil {
+		log.Printf("%+v", err)
+	}
+
+	log.Printf("running with config %s", configFile)
+
+	// wait for shutdown request
+	s := <-sig
+	log.Printf("received %s, shutting down", s)
+
+	// shutdown in standby
+	err = ctrl.SetKPA500Mode(0)
+	if err != nil {
+		log.Printf("%+v", err)
+	}
+
+	ctrl.Close()
+
+	data.Detach(hData)
+	status.Detach(hStatus)
+}
+
+// logStatusChange is the StatusChangeEventHandler, logs any device status that changed
+func logStatusChange(statuses []status.StatusValue) {
+	mutexLast.Lock()
+	defer mutexLast.Unlock()
+
+	for t, s := range statuses {
+		if t < len(lastStatus) && lastStatus[t] == s {
+			continue
+		}
+		log.Printf("status %s: %s", status.SystemStatus(t), s)
+	}
+
+	lastStatus = append(lastStatus[:0], statuses...)
+}
+
+// logDataChange is the DataChangeEventHandler, logs device data when it differs from what was last logged
+func logDataChange(d data.Data) {
+	mutexLast.Lock()
+	defer mutexLast.Unlock()
+
+	if d.Radio != lastData.Radio {
+		log.Printf("radio: frequency %d tx frequency %d band %dm split %d sub band %d mode %s filter %d data %d rf power %d tx %d po %.0f%% swr %.1f alc %.0f%% id %.1fA",
+			d.Radio.Frequency, d.Radio.TXFrequency, d.Radio.Band, d.Radio.Split, d.Radio.SubBand, d.Radio.Mode, d.Radio.Filter, d.Radio.DataMode, d.Radio.RFPower, d.Radio.Transmitting,
+			d.Radio.Po, d.Radio.SWR, d.Radio.ALC, d.Radio.Id)
+	}
+	if d.KPA500 != lastData.KPA500 {
+		log.Printf("kpa500: mode %d power %dw pa %.1fv %.1fa", d.KPA500.Mode, d.KPA500.Power, d.KPA500.PAVolts, d.KPA500.PAAmps)
+	}
+	if d.KAT500 != lastData.KAT500 {
+		log.Printf("kat500: vswr %.2f", d.KAT500.VSWR)
+	}
+
+	lastData = d
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bbathe/icom-powercombo-controller/scenario"
+)
+
+func main() {
+	var verbose bool
+
+	flag.BoolVar(&verbose, "v", false, "Show the controller log")
+	flag.Parse()
+
+	// controller log is only interesting when debugging a scenario
+	log.SetFlags(log.Ltime | log.Lmicroseconds | log.Lshortfile)
+	if !verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	// run every scenario in the directories or files passed, default is the scenarios directory
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"scenarios"}
+	}
+
+	var files []string
+	for _, a := range args {
+		fi, err := os.Stat(a)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if !fi.IsDir() {
+			files = append(files, a)
+			continue
+		}
+
+		m, err := filepath.Glob(filepath.Join(a, "*.scenario"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		files = append(files, m...)
+	}
+
+	failed := 0
+	for _, f := range files {
+		err := scenario.RunFile(f)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s\n", err)
+			continue
+		}
+		fmt.Printf("ok   %s\n", f)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,96 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/bbathe/icom-powercombo-controller/device/elecraft/sim"
+	"github.com/bbathe/icom-powercombo-controller/device/icom/lan"
+	icomsim "github.com/bbathe/icom-powercombo-controller/device/icom/sim"
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+)
+
+func main() {
+	// show file & location, date & time
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	log.SetOutput(os.Stdout)
+
+	// radio with monitor & command attachments on the same ci-v bus, each on a pseudo terminal
+	radio := icomsim.NewRadio(0x94)
+	for _, name := range []string{"monitor", "command"} {
+		t, n, err := transport.OpenPTY()
+		if err != nil {
+			log.Printf("%+v", err)
+			os.Exit(1)
+		}
+		defer t.Close()
+
+		go func() {
+			err := radio.Serve(t)
+			if err != nil {
+				log.Printf("%+v", err)
+			}
+		}()
+		log.Printf("radio %s port on %s", name, n)
+	}
+
+	// the same radio over its network remote control, on the usual port
+	server := lan.NewServer("powercombo", "powercombo", func(t transport.Transport) {
+		err := radio.Serve(t)
+		if err != nil {
+			log.Printf("%+v", err)
+		}
+	})
+	a, err := server.Listen(fmt.Sprintf("127.0.0.1:%d", lan.DefaultPort))
+	if err != nil {
+		log.Printf("%+v", err)
+		os.Exit(1)
+	}
+	defer server.Close()
+	log.Printf("radio network remote control on %s, login powercombo:powercombo", a)
+
+	// kat500 on a pseudo terminal
+	tKAT500, nKAT500, err := transport.OpenPTY()
+	if err != nil {
+		log.Printf("%+v", err)
+		os.Exit(1)
+	}
+	defer tKAT500.Close()
+
+	kat := sim.NewKAT500()
+	go func() {
+		err := kat.Serve(tKAT500)
+		if err != nil {
+			log.Printf("%+v", err)
+		}
+	}()
+	log.Printf("kat500 emulator on %s", nKAT500)
+
+	// kpa500 on a pseudo terminal
+	tKPA500, nKPA500, err := transport.OpenPTY()
+	if err != nil {
+		log.Printf("%+v", err)
+		os.Exit(1)
+	}
+	defer tKPA500.Close()
+
+	kpa := sim.NewKPA500()
+	go func() {
+		err := kpa.Serve(tKPA500)
+		if err != nil {
+			log.Printf("%+v", err)
+		}
+	}()
+	log.Printf("kpa500 emulator on %s", nKPA500)
+
+	// run until asked to stop
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+}
@@ -5,55 +5,181 @@ import (
 	"log"
 	"os"
 
-	"github.com/lxn/walk"
 	"gopkg.in/yaml.v2"
 )
 
-type mainwinposition struct {
-	X int `yaml:"topleftx"`
-	Y int `yaml:"toplefty"`
-}
+// uiSettings persists the settings the ui package hands over in UI, config doesn't know what they are
+type uiSettings struct{}
 
-func (mwp *mainwinposition) FromBounds(bounds walk.Rectangle) {
-	mwp.X = bounds.X
-	mwp.Y = bounds.Y
+func (uiSettings) MarshalYAML() (interface{}, error) {
+	return UI, nil
 }
 
-type ui struct {
-	MainWinPosition mainwinposition
+func (uiSettings) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if UI == nil {
+		return nil
+	}
+
+	return unmarshal(UI)
 }
 
+// IcomRadio is how to connect to the radio
 type IcomRadio struct {
+	// Transport selects how each device is connected: serial (default), tcp or pipe
+	// for tcp the port is host:port of a network serial server
+	Transport   string
 	MonitorPort string
+
+	// CommandPort can be left empty to send commands on the MonitorPort connection
 	CommandPort string
 	Baud        int
-	Address     string
+
+	// Model is the radio model (e.g. IC-7300), Address can be left empty to use the model's default CI-V address
+	Model   string
+	Address string
+
+	// CaptureFile, if set, is where every CI-V frame seen on the MonitorPort is recorded
+	CaptureFile string `yaml:",omitempty"`
+
+	// Retries is how many times a command is sent again when the radio answers NG or it collides on the bus
+	// (0 for the default, -1 for none)
+	Retries int `yaml:",omitempty"`
+
+	// Timeout is how long, in milliseconds, to wait for the radio to answer a command (0 for the default)
+	Timeout int `yaml:",omitempty"`
+
+	// Settle is how long, in milliseconds, the transmit frequency has to stay put before the KAT500 & KPA500 band
+	// follow it, so spinning the vfo doesn't flood them (0 for the default, -1 to follow every change)
+	Settle int `yaml:",omitempty"`
+
+	// Calibration is the radio's measured rf output for each band, RF power level (0-255) to watts, bands without one
+	// are in proportion to the model's maximum output
+	Calibration map[int]map[int]float64 `yaml:",omitempty"`
+
+	// RFPowerUnit is what the bands' radio rf power is in, RFPowerUnitWatts, empty for a configuration from before
+	// watts which holds percentages
+	RFPowerUnit string `yaml:",omitempty"`
 }
 
+// RFPowerUnitWatts is the only RFPowerUnit the radio rf power can be set from
+const RFPowerUnitWatts = "watts"
+
 type ElecraftKAT500 struct {
-	Port string
-	Baud int
+	Transport string
+	Port      string
+	Baud      int
 }
 
 type ElecraftKPA500 struct {
-	Port string
-	Baud int
+	Transport string
+	Port      string
+	Baud      int
 }
 
+// mode groups that can have their own radio rf power, see util.ModeGroup
+const (
+	ModeGroupSSB  = "ssb"
+	ModeGroupCW   = "cw"
+	ModeGroupData = "data"
+	ModeGroupAMFM = "amfm"
+)
+
+// RadioRFPower is the radio rf output in watts for each KPA500 mode
+// Modes optionally overrides Standby & Operate for a mode group, e.g. to drive the KPA500 lower for digital modes
 type RadioRFPower struct {
-	Standby int
-	Operate int
+	Standby float64
+	Operate float64
+	Modes   map[string]ModeRFPower `yaml:",omitempty"`
+}
+
+// ModeRFPower is the radio rf output in watts for a mode group, zero means use the band's output
+type ModeRFPower struct {
+	Standby float64
+	Operate float64
+}
+
+// Watts returns the radio rf output for modeGroup when the KPA500 is in operate (or standby)
+func (p RadioRFPower) Watts(modeGroup string, operate bool) float64 {
+	o := p.Modes[modeGroup]
+
+	if operate {
+		if o.Operate > 0 {
+			return o.Operate
+		}
+		return p.Operate
+	}
+
+	if o.Standby > 0 {
+		return o.Standby
+	}
+	return p.Standby
 }
 
+// KAT500Tracking is how closely the KAT500 follows the radio's frequency on a band, in kHz
+// the KAT500 is sent a new frequency when it crosses into another Segment (e.g. the width of the KAT500's tuning memories)
+// or has moved at least Step from the last one sent, with neither set it is sent every kHz the frequency moves
+type KAT500Tracking struct {
+	Segment int64 `yaml:",omitempty"`
+	Step    int64 `yaml:",omitempty"`
+}
+
+// Follow returns true if the KAT500 should be sent freq (kHz) when it was last sent last (kHz) on the same band
+func (t KAT500Tracking) Follow(last int64, freq int64) bool {
+	if t.Segment <= 0 && t.Step <= 0 {
+		return freq != last
+	}
+
+	if t.Segment > 0 && freq/t.Segment != last/t.Segment {
+		return true
+	}
+
+	d := freq - last
+	if d < 0 {
+		d = -d
+	}
+
+	return t.Step > 0 && d >= t.Step
+}
+
+// ConvertRFPowerPercentages converts the bands' radio rf power from percentages to watts of a maxPower watt radio,
+// for a configuration from before watts
+func ConvertRFPowerPercentages(maxPower int) {
+	watts := func(percent float64) float64 {
+		return percent * float64(maxPower) / 100
+	}
+
+	for k, b := range Bands {
+		b.RadioRFPower.Standby = watts(b.RadioRFPower.Standby)
+		b.RadioRFPower.Operate = watts(b.RadioRFPower.Operate)
+
+		modes := make(map[string]ModeRFPower, len(b.RadioRFPower.Modes))
+		for mg, p := range b.RadioRFPower.Modes {
+			modes[mg] = ModeRFPower{Standby: watts(p.Standby), Operate: watts(p.Operate)}
+		}
+		if len(modes) > 0 {
+			b.RadioRFPower.Modes = modes
+		}
+
+		Bands[k] = b
+	}
+
+	Radio.RFPowerUnit = RFPowerUnitWatts
+}
+
+// Band is a band's frequency range and how the radio is set up on it
+// RadioATU turns the radio's internal antenna tuner on while the KPA500 is in standby, it's always bypassed in operate
+// because the KAT500 is doing the matching
 type Band struct {
-	Low          int64
-	High         int64
-	RadioRFPower RadioRFPower
+	Low            int64
+	High           int64
+	RadioRFPower   RadioRFPower
+	RadioATU       bool           `yaml:",omitempty"`
+	KAT500Tracking KAT500Tracking `yaml:",omitempty"`
 }
 
 // Configuration is the struct that is serialized to file
 type Configuration struct {
-	UI     ui
+	UI     uiSettings
 	Radio  IcomRadio
 	KAT500 ElecraftKAT500
 	KPA500 ElecraftKPA500
@@ -61,8 +187,11 @@ type Configuration struct {
 }
 
 var (
+	// UI points to the ui package's own settings (e.g. the main window position) so they're read & written with the
+	// configuration, nil without a ui
+	UI interface{}
+
 	// unwrapped config values
-	UI     ui
 	Radio  IcomRadio
 	KAT500 ElecraftKAT500
 	KPA500 ElecraftKPA500
@@ -87,7 +216,6 @@ func Read(fname string) error {
 	}
 
 	// unwrap config values
-	UI = c.UI
 	Radio = c.Radio
 	KAT500 = c.KAT500
 	KPA500 = c.KPA500
@@ -96,6 +224,26 @@ func Read(fname string) error {
 	return nil
 }
 
+// SetDefaults sets all configuration values to what a new configuration starts with
+func SetDefaults() {
+	Radio = IcomRadio{RFPowerUnit: RFPowerUnitWatts}
+	KAT500 = ElecraftKAT500{}
+	KPA500 = ElecraftKPA500{}
+
+	Bands = make(map[int]Band)
+	Bands[6] = Band{Low: 50000000, High: 54000000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
+	Bands[10] = Band{Low: 28000000, High: 29700000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
+	Bands[12] = Band{Low: 24890000, High: 24990000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
+	Bands[15] = Band{Low: 21000000, High: 21450000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
+	Bands[17] = Band{Low: 18068000, High: 18168000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
+	Bands[20] = Band{Low: 14000000, High: 14350000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
+	Bands[30] = Band{Low: 10100000, High: 10150000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 10}}
+	Bands[40] = Band{Low: 7000000, High: 7300000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
+	Bands[60] = Band{Low: 5240000, High: 5500000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 5}}
+	Bands[80] = Band{Low: 3500000, High: 4000000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
+	Bands[160] = Band{Low: 1800000, High: 2000000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
+}
+
 // ReadOrCreate loads application configuration or creates a new file named fname
 // returns true if config was "created"
 func ReadOrCreate(fname string) (bool, error) {
@@ -104,29 +252,7 @@ func ReadOrCreate(fname string) (bool, error) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			// bootstrap some defaults
-			UI = ui{
-				MainWinPosition: mainwinposition{
-					X: 200,
-					Y: 200,
-				},
-			}
-
-			Radio = IcomRadio{}
-			KAT500 = ElecraftKAT500{}
-			KPA500 = ElecraftKPA500{}
-
-			Bands = make(map[int]Band)
-			Bands[6] = Band{Low: 50000000, High: 54000000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
-			Bands[10] = Band{Low: 28000000, High: 29700000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
-			Bands[12] = Band{Low: 24890000, High: 24990000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
-			Bands[15] = Band{Low: 21000000, High: 21450000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
-			Bands[17] = Band{Low: 18068000, High: 18168000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
-			Bands[20] = Band{Low: 14000000, High: 14350000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
-			Bands[30] = Band{Low: 10100000, High: 10150000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 10}}
-			Bands[40] = Band{Low: 7000000, High: 7300000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
-			Bands[60] = Band{Low: 5240000, High: 5500000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 5}}
-			Bands[80] = Band{Low: 3500000, High: 4000000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
-			Bands[160] = Band{Low: 1800000, High: 2000000, RadioRFPower: RadioRFPower{Standby: 100, Operate: 30}}
+			SetDefaults()
 
 			return true, nil
 		}
@@ -139,7 +265,6 @@ func ReadOrCreate(fname string) (bool, error) {
 func Write(fname string) error {
 	// wrap config values
 	c := Configuration{
-		UI:     UI,
 		Radio:  Radio,
 		KAT500: KAT500,
 		KPA500: KPA500,
@@ -1,18 +1,28 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"sync"
 
 	"github.com/bbathe/icom-powercombo-controller/config"
 	"github.com/bbathe/icom-powercombo-controller/data"
+	"github.com/bbathe/icom-powercombo-controller/device"
 	"github.com/bbathe/icom-powercombo-controller/device/elecraft"
 	"github.com/bbathe/icom-powercombo-controller/device/icom"
+	"github.com/bbathe/icom-powercombo-controller/util"
 )
 
 type command struct {
 	r   *icom.Radio
 	kpa *elecraft.KPA500
 	kat *elecraft.KAT500
+
+	// what the KAT500 was last sent, frequency in kHz, 0 if it isn't known
+	mutexKAT500     sync.Mutex
+	kat500Frequency int64
+	kat500Band      int
 }
 
 func (c *command) close() {
@@ -21,32 +31,16 @@ func (c *command) close() {
 	c.kat.Close()
 }
 
-func newCommand() *command {
-	// connect to radio
-	r, err := icom.OpenRadio(config.Radio.CommandPort, config.Radio.Baud, config.Radio.Address)
-	if err != nil {
-		log.Printf("%+v", err)
-		return nil
-	}
-
-	// connect to kat500
-	kat, err := elecraft.OpenKAT500(config.KAT500.Port, config.KAT500.Baud)
-	if err != nil {
-		log.Printf("%+v", err)
-		return nil
-	}
-
-	// connect to kpa500
-	kpa, err := elecraft.OpenKPA500(config.KPA500.Port, config.KPA500.Baud)
-	if err != nil {
-		log.Printf("%+v", err)
-		return nil
-	}
-
+// newCommand creates the device connections used for sending commands, they are connected by their supervisors
+// without a command port, commands to the radio share the monitor connection r
+func newCommand(r *icom.Radio) *command {
 	c := new(command)
 	c.r = r
-	c.kpa = kpa
-	c.kat = kat
+	if config.Radio.CommandPort != "" {
+		c.r = newRadio(config.Radio.CommandPort)
+	}
+	c.kat = elecraft.NewKAT500(config.KAT500.Transport, config.KAT500.Port, config.KAT500.Baud)
+	c.kpa = elecraft.NewKPA500(config.KPA500.Transport, config.KPA500.Port, config.KPA500.Baud)
 
 	return c
 }
@@ -65,14 +59,22 @@ func (c *command) updateKPA500Mode() error {
 }
 
 func (c *command) updateRadioRFPower() error {
+	// a configuration that couldn't be converted isn't trusted, which also keeps the kpa500 out of operate
+	if config.Radio.RFPowerUnit != config.RFPowerUnitWatts {
+		err := fmt.Errorf("radio rf power in the configuration is in %q, not %s", config.Radio.RFPowerUnit, config.RFPowerUnitWatts)
+		log.Printf("%+v", err)
+		return err
+	}
+
 	r := data.GetRadioData()
-	kpa := data.GetKPA500Data()
 
-	var err error
-	if kpa.Mode == 1 {
-		err = c.r.SetRFPower(config.Bands[r.Band].RadioRFPower.Operate)
-	} else {
-		err = c.r.SetRFPower(config.Bands[r.Band].RadioRFPower.Standby)
+	level, err := c.r.SetRFPower(r.Band, radioRFPowerWatts())
+
+	// publish what the radio is really set to, even if it isn't what we asked for
+	if level > -1 {
+		update := data.UnchangedRadio()
+		update.RFPower = level
+		update.Update()
 	}
 	if err != nil {
 		log.Printf("%+v", err)
@@ -82,6 +84,46 @@ func (c *command) updateRadioRFPower() error {
 	return nil
 }
 
+// radioRFPowerWatts returns the radio rf power configured for the band, mode & KPA500 mode
+func radioRFPowerWatts() float64 {
+	r := data.GetRadioData()
+	kpa := data.GetKPA500Data()
+
+	mg := util.ModeGroup(r.Mode, r.DataMode == 1)
+
+	return config.Bands[r.Band].RadioRFPower.Watts(mg, kpa.Mode == 1)
+}
+
+// isRadioRFPowerDecrease returns true if the radio rf power for the band, mode & KPA500 mode is a lower level than the
+// radio is set to
+func (c *command) isRadioRFPowerDecrease() bool {
+	r := data.GetRadioData()
+
+	curve := c.r.PowerCurve(r.Band)
+	if len(curve) == 0 {
+		return false
+	}
+
+	return curve.Level(radioRFPowerWatts()) < r.RFPower
+}
+
+// updateRadioATU sets the radio's internal tuner for the band & KPA500 mode, radios without one are left alone
+func (c *command) updateRadioATU() error {
+	r := data.GetRadioData()
+	kpa := data.GetKPA500Data()
+
+	// the KAT500 matches for the amplifier, only barefoot can the radio's tuner be wanted
+	on := kpa.Mode == 0 && config.Bands[r.Band].RadioATU
+
+	err := c.r.SetATU(on)
+	if err != nil && !errors.Is(err, device.ErrNotSupported) {
+		log.Printf("%+v", err)
+		return err
+	}
+
+	return nil
+}
+
 func (c *command) updateKPA500Band() error {
 	r := data.GetRadioData()
 
@@ -94,61 +136,120 @@ func (c *command) updateKPA500Band() error {
 	return nil
 }
 
-func (c *command) updateKAT500Frequency() error {
+// forgetKAT500Frequency makes the next update send the KAT500 the frequency however little it has moved
+func (c *command) forgetKAT500Frequency() {
+	c.mutexKAT500.Lock()
+	defer c.mutexKAT500.Unlock()
+
+	c.kat500Frequency = 0
+}
+
+// updateKAT500Frequency sends the KAT500 the transmit frequency if it has moved far enough on the band to need it,
+// or always when force is set, e.g. when the KAT500 has just been reconnected
+func (c *command) updateKAT500Frequency(force bool) error {
+	c.mutexKAT500.Lock()
+	defer c.mutexKAT500.Unlock()
+
 	r := data.GetRadioData()
+	f := r.TXFrequency / 1000
+
+	// a new band always gets its frequency
+	if !force && r.Band == c.kat500Band && c.kat500Frequency > 0 && !config.Bands[r.Band].KAT500Tracking.Follow(c.kat500Frequency, f) {
+		return nil
+	}
 
-	err := c.kat.SetFrequency(r.Frequency)
+	err := c.kat.SetFrequency(r.TXFrequency)
 	if err != nil {
+		// the KAT500 may or may not have it
+		c.kat500Frequency = 0
 		log.Printf("%+v", err)
 		return err
 	}
 
+	c.kat500Frequency = f
+	c.kat500Band = r.Band
+
 	return nil
 }
 
 func (c *command) setKPA500Mode(mode int) error {
-	var err error
-
-	// get current mode to tell what order to update kpa500 & radio
+	// get current mode to put back if the radio can't be made ready for operate
 	kpa := data.GetKPA500Data()
 
+	// nothing is switched under the radio while it's transmitting, the monitor switches once it's back on receive
+	// the radio is asked, the shared state is only polled every statePollInterval
+	tx, err := c.getRadioTransmitting()
+	if err != nil {
+		log.Printf("%+v", err)
+
+		// standby doesn't wait for the radio
+		if mode != 0 {
+			return err
+		}
+	}
+	if tx {
+		controller.m.hold(pending{kpa500Mode: true, kpa500ModeTo: mode})
+		return nil
+	}
+
+	return c.switchKPA500Mode(mode, kpa.Mode)
+}
+
+// switchKPA500Mode puts the kpa500 in mode with the radio rf power & tuner set for it, in an order that never has the
+// radio turned up into the kpa500 in operate, the shared state goes back to prev if the radio can't be made ready
+func (c *command) switchKPA500Mode(mode int, prev int) error {
 	// update state
-	data.KPA500{
-		Mode:    mode,
-		Power:   -1,
-		PAVolts: -1,
-		PAAmps:  -1,
-	}.Update()
+	c.publishKPA500Mode(mode)
 
-	if kpa.Mode > mode {
-		// operate -> standby
+	var err error
+
+	// a kpa500 whose port is closed is being reconnected, its supervisor brings it in line with the new mode once it's back
+	if mode == 0 {
+		// -> standby, a radio being reconnected is brought in line by its supervisor too
 
 		// update kpa500 mode
 		err = c.updateKPA500Mode()
-		if err != nil {
+		if err != nil && !errors.Is(err, device.ErrPortClosed) {
 			log.Printf("%+v", err)
 			return err
 		}
 
 		// update radio rf power
 		err = c.updateRadioRFPower()
-		if err != nil {
+		if err != nil && !errors.Is(err, device.ErrPortClosed) {
+			log.Printf("%+v", err)
+			return err
+		}
+
+		// update radio tuner
+		err = c.updateRadioATU()
+		if err != nil && !errors.Is(err, device.ErrPortClosed) {
 			log.Printf("%+v", err)
 			return err
 		}
 	} else {
-		// standby -> operate
+		// -> operate
+		// the radio has to be turned down first, even if it's only reconnecting, or the kpa500 stays in standby
+
+		// radio tuner out of the way before anything else, don't go to operate if it can't be
+		err = c.updateRadioATU()
+		if err != nil {
+			log.Printf("%+v", err)
+			c.publishKPA500Mode(prev)
+			return err
+		}
 
 		// update radio rf power
 		err = c.updateRadioRFPower()
 		if err != nil {
 			log.Printf("%+v", err)
+			c.publishKPA500Mode(prev)
 			return err
 		}
 
 		// update kpa500 mode
 		err = c.updateKPA500Mode()
-		if err != nil {
+		if err != nil && !errors.Is(err, device.ErrPortClosed) {
 			log.Printf("%+v", err)
 			return err
 		}
@@ -157,6 +258,16 @@ func (c *command) setKPA500Mode(mode int) error {
 	return nil
 }
 
+// publishKPA500Mode sets the kpa500 mode in the shared state, or puts it back when the kpa500 wasn't switched
+func (c *command) publishKPA500Mode(mode int) {
+	data.KPA500{
+		Mode:    mode,
+		Power:   -1,
+		PAVolts: -1,
+		PAAmps:  -1,
+	}.Update()
+}
+
 func (c *command) getKAT500InFault() (bool, error) {
 	fault, err := c.kat.GetFault()
 	if err != nil {
@@ -216,3 +327,24 @@ func (c *command) getKPA500PAVoltsCurrent() (float64, float64, error) {
 
 	return volts, amps, nil
 }
+
+// getRadioTransmitting asks the radio whether it's transmitting, one that can't tell us never is
+func (c *command) getRadioTransmitting() (bool, error) {
+	tx, err := c.r.GetTransmitting()
+	if err != nil && !errors.Is(err, device.ErrNotSupported) {
+		log.Printf("%+v", err)
+		return false, err
+	}
+
+	return tx, nil
+}
+
+func (c *command) getRadioMeters() (icom.Meters, error) {
+	meters, err := c.r.GetMeters()
+	if err != nil {
+		log.Printf("%+v", err)
+		return icom.Meters{}, err
+	}
+
+	return meters, nil
+}
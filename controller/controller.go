@@ -1,10 +1,23 @@
 package controller
 
-import "github.com/bbathe/icom-powercombo-controller/status"
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/bbathe/icom-powercombo-controller/config"
+	"github.com/bbathe/icom-powercombo-controller/device/icom"
+	"github.com/bbathe/icom-powercombo-controller/status"
+)
 
 type Controller struct {
 	c *command
 	m *monitor
+
+	// connection supervisors for each device
+	radio  *supervisor
+	kat500 *supervisor
+	kpa500 *supervisor
 }
 
 var (
@@ -13,20 +26,61 @@ var (
 
 func NewController() *Controller {
 	if controller == nil {
-		controller = new(Controller)
+		convertRFPower()
 
-		c := newCommand()
-		controller.c = c
+		controller = new(Controller)
 
 		m := newMonitor()
 		controller.m = m
+
+		c := newCommand(m.r)
+		controller.c = c
+
+		controller.radio = newSupervisor(status.SystemStatusRadio, controller.reopenRadio, m.initializeRadio)
+		controller.kat500 = newSupervisor(status.SystemStatusKAT500, c.kat.Reopen, m.initializeKAT500)
+		controller.kpa500 = newSupervisor(status.SystemStatusKPA500, c.kpa.Reopen, m.initializeKPA500)
+
+		m.start()
 	}
 
 	return controller
 }
 
+// convertRFPower converts the radio rf power in a configuration from before watts, percentages of the model's maximum
+// left alone if the model isn't known, rf power isn't set from a configuration that isn't in watts
+func convertRFPower() {
+	if config.Radio.RFPowerUnit != "" {
+		return
+	}
+
+	m, err := icom.LookupModel(config.Radio.Model)
+	if err != nil {
+		log.Printf("%+v", err)
+		return
+	}
+
+	config.ConvertRFPowerPercentages(m.MaxPower)
+	log.Printf("radio rf power in the configuration converted from percentages to watts of a %d W radio", m.MaxPower)
+}
+
 func (c *Controller) Close() {
+	// stop reconnecting before closing everything down
+	c.radio.close()
+	c.kat500.close()
+	c.kpa500.close()
+
 	c.m.close()
+
+	// a switch to standby held while transmitting, don't leave the kpa500 in operate
+	if mode, ok := c.m.heldKPA500Mode(); ok && mode == 0 {
+		c.c.publishKPA500Mode(mode)
+
+		err := c.c.updateKPA500Mode()
+		if err != nil {
+			log.Printf("%+v", err)
+		}
+	}
+
 	c.c.close()
 
 	status.SetStatuses(status.StatusUnknown)
@@ -34,6 +88,49 @@ func (c *Controller) Close() {
 	controller = nil
 }
 
+// newRadio creates a connection to the radio on port, it is connected by its supervisor
+func newRadio(port string) *icom.Radio {
+	r := icom.NewRadio(config.Radio.Transport, port, config.Radio.Baud, config.Radio.Model, config.Radio.Address)
+	r.Retries = config.Radio.Retries
+	r.Timeout = time.Duration(config.Radio.Timeout) * time.Millisecond
+
+	// a bad calibration is left out, the band falls back to the model's maximum output in proportion to the level
+	r.Calibration = make(map[int]icom.PowerCurve)
+	for band, levels := range config.Radio.Calibration {
+		c := make(icom.PowerCurve, 0, len(levels))
+		for level, watts := range levels {
+			c = append(c, icom.PowerPoint{Level: level, Watts: watts})
+		}
+		sort.Slice(c, func(i, j int) bool {
+			return c[i].Level < c[j].Level
+		})
+
+		err := c.Validate()
+		if err != nil {
+			log.Printf("ignoring %dm radio calibration: %v", band, err)
+			continue
+		}
+		r.Calibration[band] = c
+	}
+
+	return r
+}
+
+// reopenRadio reconnects both the monitor & command connections to the radio
+func (c *Controller) reopenRadio() error {
+	err := c.m.r.Reopen()
+	if err != nil {
+		return err
+	}
+
+	// single port?
+	if c.c.r == c.m.r {
+		return nil
+	}
+
+	return c.c.r.Reopen()
+}
+
 // SetKPA500Mode exposes setting the KPA500 mode (operate/standby) to the UI
 func (c *Controller) SetKPA500Mode(mode int) error {
 	return c.c.setKPA500Mode(mode)
@@ -46,5 +143,9 @@ func (c *Controller) KAT500FullTune() error {
 
 // SetTrackKAT500 indictes whether frequency information should be sent to the KAT500
 func (c *Controller) SetTrackKAT500(t bool) {
+	// the KAT500 may have been moved by hand while it wasn't following
+	if t {
+		c.c.forgetKAT500Frequency()
+	}
 	c.m.trackKAT500 = t
 }
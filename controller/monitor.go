@@ -1,64 +1,132 @@
 package controller
 
 import (
+	"errors"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/bbathe/icom-powercombo-controller/config"
 	"github.com/bbathe/icom-powercombo-controller/data"
+	"github.com/bbathe/icom-powercombo-controller/device"
 	"github.com/bbathe/icom-powercombo-controller/device/icom"
 	"github.com/bbathe/icom-powercombo-controller/status"
 	"github.com/bbathe/icom-powercombo-controller/util"
 )
 
+var (
+	// how long to wait for the radio to report its frequency when (re)connecting
+	radioFrequencyTimeout = 3 * time.Second
+
+	// how often to ask the radio if it's transmitting & about split
+	statePollInterval = 250 * time.Millisecond
+
+	// how long the transmit frequency has to stay put before the kat500 & kpa500 band follow it, unless config.Radio.Settle is set
+	frequencySettle = 250 * time.Millisecond
+
+	// size the CI-V capture file gets to before it's rotated & how many old ones are kept
+	captureMaxSize int64 = 10 * 1024 * 1024
+	captureBackups       = 5
+)
+
+// pending is the changes waiting to be sent to the devices, they are held while the radio is transmitting
+// kpa500ModeTo is the mode a held kpa500Mode switch is to
+type pending struct {
+	kat500Frequency bool
+	kpa500Band      bool
+	kpa500Mode      bool
+	kpa500ModeTo    int
+	rfPower         bool
+	radioATU        bool
+}
+
 type monitor struct {
 	r *icom.Radio
 
+	// capture is where the CI-V traffic is recorded, nil if it isn't
+	capture *util.RotatingFile
+
 	quit    chan bool
+	done    chan bool
 	qKAT500 chan bool
 	qKPA500 chan bool
-
-	freq int64
-	band int
+	qRadio  chan bool
 
 	trackKAT500 bool
+
+	// settle is how long the transmit frequency has to stay put before the kat500 & kpa500 band follow it,
+	// lastFrequencyChange is when it last moved
+	settle              time.Duration
+	lastFrequencyChange time.Time
+
+	lastStatePoll time.Time
+
+	mutexPending sync.Mutex
+	pending      pending
 }
 
 func (m *monitor) close() {
 	close(m.quit)
-	close(m.qKAT500)
-	close(m.qKPA500)
+
+	// sending waits for a task in progress to finish
+	m.qKAT500 <- true
+	m.qKPA500 <- true
+	m.qRadio <- true
 	m.r.Close()
-}
 
-// newMonitor spins off all the seperate processes for monitoring all devices
-func newMonitor() *monitor {
-	// connect to radio
-	r, err := icom.OpenRadio(config.Radio.MonitorPort, config.Radio.Baud, config.Radio.Address)
-	if err != nil {
-		log.Printf("%+v", err)
-		status.SetStatus(status.SystemStatusRadio, status.StatusFailed)
-		return nil
+	// wait for monitor loop to finish
+	<-m.done
+
+	if m.capture != nil {
+		err := m.capture.Close()
+		if err != nil {
+			log.Printf("%+v", err)
+		}
 	}
-	status.SetStatus(status.SystemStatusRadio, status.StatusOK)
+}
 
+// newMonitor creates the monitor connection to the radio, it is connected by its supervisor
+func newMonitor() *monitor {
 	m := new(monitor)
-	m.r = r
+	m.r = newRadio(config.Radio.MonitorPort)
 	m.trackKAT500 = true
 
-	err = m.initializeDevices()
-	if err != nil {
-		log.Printf("%+v", err)
-		return nil
+	m.settle = frequencySettle
+	switch {
+	case config.Radio.Settle < 0:
+		m.settle = 0
+	case config.Radio.Settle > 0:
+		m.settle = time.Duration(config.Radio.Settle) * time.Millisecond
 	}
 
+	// record the bus traffic, the hub lets the monitor port see everything
+	if config.Radio.CaptureFile != "" {
+		m.capture = util.NewRotatingFile(config.Radio.CaptureFile, captureMaxSize, captureBackups)
+		m.r.SetSniffer(icom.NewSniffer(m.capture))
+	}
+
+	return m
+}
+
+// start connects to all devices and spins off all the seperate processes for monitoring them
+func (m *monitor) start() {
+	// kat500 & kpa500 first so they are ready to follow the radio
+	controller.kat500.connect()
+	controller.kpa500.connect()
+	controller.radio.connect()
+
 	// KAT500 monitor task
 	m.qKAT500 = util.ScheduleRecurring(func() {
+		// nothing to do while reconnecting
+		if controller.kat500.isReconnecting() {
+			return
+		}
+
 		// see if kat500 in fault
 		f, err := controller.c.getKAT500InFault()
 		if err != nil {
 			log.Printf("%+v", err)
-			status.SetStatus(status.SystemStatusKAT500, status.StatusFailed)
+			controller.kat500.failed(err)
 			return
 		}
 
@@ -73,7 +141,7 @@ func newMonitor() *monitor {
 		v, err := controller.c.getKAT500VSWR()
 		if err != nil {
 			log.Printf("%+v", err)
-			status.SetStatus(status.SystemStatusKAT500, status.StatusFailed)
+			controller.kat500.failed(err)
 			return
 		}
 
@@ -87,11 +155,16 @@ func newMonitor() *monitor {
 
 	// KPA500 monitor task
 	m.qKPA500 = util.ScheduleRecurring(func() {
+		// nothing to do while reconnecting
+		if controller.kpa500.isReconnecting() {
+			return
+		}
+
 		// see if kpa500 in fault
 		f, err := controller.c.getKPA500InFault()
 		if err != nil {
 			log.Printf("%+v", err)
-			status.SetStatus(status.SystemStatusKPA500, status.StatusFailed)
+			controller.kpa500.failed(err)
 			return
 		}
 
@@ -106,7 +179,7 @@ func newMonitor() *monitor {
 		p, err := controller.c.getKPA500Power()
 		if err != nil {
 			log.Printf("%+v", err)
-			status.SetStatus(status.SystemStatusKPA500, status.StatusFailed)
+			controller.kpa500.failed(err)
 			return
 		}
 
@@ -114,7 +187,7 @@ func newMonitor() *monitor {
 		v, a, err := controller.c.getKPA500PAVoltsCurrent()
 		if err != nil {
 			log.Printf("%+v", err)
-			status.SetStatus(status.SystemStatusKPA500, status.StatusFailed)
+			controller.kpa500.failed(err)
 			return
 		}
 
@@ -129,158 +202,588 @@ func newMonitor() *monitor {
 		status.SetStatus(status.SystemStatusKPA500, status.StatusOK)
 	}, 1*time.Second)
 
+	// radio meter task
+	m.qRadio = util.ScheduleRecurring(func() {
+		// nothing to do while reconnecting
+		if controller.radio.isReconnecting() {
+			return
+		}
+
+		// the meters only read something while transmitting, zero them once back on receive
+		rd := data.GetRadioData()
+		if rd.Transmitting != 1 {
+			if rd.Po != 0 || rd.SWR != 0 || rd.ALC != 0 || rd.Id != 0 {
+				update := data.UnchangedRadio()
+				update.Po = 0
+				update.SWR = 0
+				update.ALC = 0
+				update.Id = 0
+				update.Update()
+			}
+			return
+		}
+
+		mt, err := controller.c.getRadioMeters()
+		if err != nil {
+			// radio doesn't have meters
+			if errors.Is(err, device.ErrNotSupported) {
+				return
+			}
+			controller.radio.failed(err)
+			return
+		}
+
+		// update state with what we know
+		update := data.UnchangedRadio()
+		update.Po = mt.Po
+		update.SWR = mt.SWR
+		update.ALC = mt.ALC
+		update.Id = mt.Id
+		update.Update()
+	}, 1*time.Second)
+
 	// kick off monitor loop
 	m.quit = make(chan bool)
+	m.done = make(chan bool)
 	go m.monitorRadio()
-
-	return m
 }
 
 // monitorRadio keeps the KAT500 & KPA500 in-sync with the frequency on the radio
 func (m *monitor) monitorRadio() {
+	defer close(m.done)
+
 	// while not quit
 	for {
 		select {
 		case <-m.quit:
 			return
 		default:
-			f, err := m.r.GetFrequency()
+			// wait for supervisor to get the radio back
+			if controller.radio.isReconnecting() {
+				select {
+				case <-m.quit:
+					return
+				case <-time.After(100 * time.Millisecond):
+				}
+				continue
+			}
+
+			// transmitting? split?
+			tx, err := m.updateRadioState()
 			if err != nil {
 				log.Printf("%+v", err)
-				status.SetStatus(status.SystemStatusRadio, status.StatusFailed)
-				return
+				controller.radio.failed(err)
+				continue
+			}
+
+			// mode changed?
+			changed, err := m.updateRadioMode()
+			if err != nil {
+				log.Printf("%+v", err)
+				controller.radio.failed(err)
+				continue
+			}
+			if changed {
+				m.hold(pending{rfPower: true})
 			}
-			status.SetStatus(status.SystemStatusRadio, status.StatusOK)
 
-			// no update or no frequency change?
-			if f < 0 || f == m.freq {
+			// frequency changed?
+			err = m.updateRadioFrequency()
+			if err != nil {
+				log.Printf("%+v", err)
+				controller.radio.failed(err)
 				continue
 			}
 
-			m.freq = f
+			// don't change anything under the radio while it's transmitting,
+			// the kat500 & kpa500 band don't follow the vfo while it's still being spun
+			settled := time.Since(m.lastFrequencyChange) >= m.settle
+			if tx || !m.isPending(settled) {
+				continue
+			}
 
-			b, err := util.BandFromFrequency(f)
+			// the transmit state can be up to statePollInterval old, ask again right before changing anything
+			tx, err = m.readRadioTransmitting()
 			if err != nil {
+				log.Printf("%+v", err)
+				controller.radio.failed(err)
 				continue
 			}
-
-			// update state
-			data.Radio{
-				Frequency: f,
-				Band:      b,
-			}.Update()
-
-			//
-			// coordinated frequency change across all devices
-			//
-
-			// update kat500 frequency
-			if m.trackKAT500 {
-				err = controller.c.updateKAT500Frequency()
-				if err != nil {
-					log.Printf("%+v", err)
-					status.SetStatus(status.SystemStatusKAT500, status.StatusFailed)
-					continue
-				}
+			if !tx {
+				m.applyPending(settled)
 			}
+		}
+	}
+}
 
-			// band change?
-			if b != m.band {
-				m.band = b
+// updateRadioState polls the radio for whether it's transmitting and, while receiving, where it will transmit next
+// the radio is asked no more than every statePollInterval, returns true if transmitting
+func (m *monitor) updateRadioState() (bool, error) {
+	if time.Since(m.lastStatePoll) < statePollInterval {
+		return data.GetRadioData().Transmitting == 1, nil
+	}
 
-				// update kpa500 band
-				err = controller.c.updateKPA500Band()
-				if err != nil {
-					log.Printf("%+v", err)
-					status.SetStatus(status.SystemStatusKPA500, status.StatusFailed)
-					continue
-				}
+	tx, err := m.readRadioTransmitting()
+	if err != nil {
+		log.Printf("%+v", err)
+		return false, err
+	}
+	m.lastStatePoll = time.Now()
 
-				// update radio rf power
-				err = controller.c.updateRadioRFPower()
-				if err != nil {
-					log.Printf("%+v", err)
-					status.SetStatus(status.SystemStatusRadio, status.StatusFailed)
-					continue
-				}
-			}
+	// the vfos can swap around while transmitting split, only follow them on receive
+	if tx {
+		return true, nil
+	}
+
+	txf, err := m.readRadioSplit(data.GetRadioData().Frequency)
+	if err != nil {
+		log.Printf("%+v", err)
+		return false, err
+	}
+
+	m.updateTXFrequency(txf)
+
+	return false, nil
+}
+
+// readRadioTransmitting asks the radio whether it's transmitting and updates the shared state
+func (m *monitor) readRadioTransmitting() (bool, error) {
+	tx, err := m.r.GetTransmitting()
+	if err != nil && !errors.Is(err, device.ErrNotSupported) {
+		log.Printf("%+v", err)
+		return false, err
+	}
+
+	t := 0
+	if tx {
+		t = 1
+	}
+
+	update := data.UnchangedRadio()
+	update.Transmitting = t
+	update.Update()
+
+	return tx, nil
+}
+
+// readRadioSplit asks the radio about split & main/sub band and updates the shared state
+// returns the frequency the radio will transmit on, f is the operating frequency
+func (m *monitor) readRadioSplit(f int64) (int64, error) {
+	split, err := m.r.GetSplit()
+	if err != nil && !errors.Is(err, device.ErrNotSupported) {
+		log.Printf("%+v", err)
+		return 0, err
+	}
+
+	sb := -1
+	sub, err := m.r.GetSubBand()
+	switch {
+	case err == nil:
+		sb = 0
+		if sub {
+			sb = 1
+		}
+	case !errors.Is(err, device.ErrNotSupported):
+		log.Printf("%+v", err)
+		return 0, err
+	}
+
+	sp := 0
+	if split {
+		sp = 1
+	}
+
+	// the transmit vfo isn't the selected one?
+	if !transmitsOnSelected(sp, sb) {
+		f, err = m.r.GetVFOFrequency(false)
+		if err != nil {
+			log.Printf("%+v", err)
+			return 0, err
 		}
 	}
+
+	update := data.UnchangedRadio()
+	update.Split = sp
+	update.SubBand = sb
+	update.Update()
+
+	return f, nil
+}
+
+// transmitsOnSelected returns true if the radio transmits on the selected vfo, where the operating frequency is
+// radios with main & sub bands transmit on the main band, or on the sub band when split, others on the unselected vfo
+// when split
+func transmitsOnSelected(split int, subBand int) bool {
+	return (split == 1) == (subBand == 1)
 }
 
-// initializeDevices makes sure the internal state is consistent with external devices
-func (m *monitor) initializeDevices() error {
-	var err error
+// updateRadioFrequency updates the shared state with the radio's operating frequency if it has changed
+// and, when it's also where the radio transmits, holds the changes the other devices need
+func (m *monitor) updateRadioFrequency() error {
+	f, err := m.r.GetFrequency()
+	if err != nil {
+		// radio only sends its frequency when it changes
+		if errors.Is(err, device.ErrTimeout) {
+			return nil
+		}
+		log.Printf("%+v", err)
+		return err
+	}
+
+	// no frequency change?
+	rd := data.GetRadioData()
+	if f == rd.Frequency {
+		return nil
+	}
+
+	// update state
+	update := data.UnchangedRadio()
+	update.Frequency = f
+	update.Update()
+
+	// transmits somewhere else
+	if !transmitsOnSelected(rd.Split, rd.SubBand) {
+		return nil
+	}
+
+	m.updateTXFrequency(f)
+
+	return nil
+}
+
+// updateTXFrequency updates the shared state with the frequency the radio transmits on if it has changed
+// and holds the changes the other devices need to follow it
+func (m *monitor) updateTXFrequency(txf int64) {
+	// no frequency change?
+	rd := data.GetRadioData()
+	if txf == rd.TXFrequency {
+		return
+	}
 
-	// set all device statuses based on error from any
-	defer func() {
+	b, err := util.BandFromFrequency(txf)
+	if err != nil {
+		return
+	}
+
+	// update state
+	update := data.UnchangedRadio()
+	update.TXFrequency = txf
+	update.Band = b
+	update.Update()
+
+	//
+	// coordinated frequency change across all devices, the kat500 & kpa500 band once the frequency settles
+	//
+	m.lastFrequencyChange = time.Now()
+	m.hold(pending{
+		kat500Frequency: m.trackKAT500,
+		kpa500Band:      b != rd.Band,
+		rfPower:         b != rd.Band,
+		radioATU:        b != rd.Band,
+	})
+}
+
+// hold adds p to the changes waiting to be sent to the devices
+func (m *monitor) hold(p pending) {
+	m.mutexPending.Lock()
+	defer m.mutexPending.Unlock()
+
+	m.pending.kat500Frequency = m.pending.kat500Frequency || p.kat500Frequency
+	m.pending.kpa500Band = m.pending.kpa500Band || p.kpa500Band
+	if p.kpa500Mode {
+		// the last switch asked for wins
+		m.pending.kpa500Mode = true
+		m.pending.kpa500ModeTo = p.kpa500ModeTo
+	}
+	m.pending.rfPower = m.pending.rfPower || p.rfPower
+	m.pending.radioATU = m.pending.radioATU || p.radioATU
+}
+
+// due splits the held changes into those that can be sent now and those that have to keep waiting
+// the kat500 frequency & kpa500 band wait for the frequency to settle, and until the kpa500 is on the new band the
+// radio isn't turned up into it, only a lower rf power goes out first and a switch to operate waits too
+func (p pending) due(settled bool) (pending, pending) {
+	if settled {
+		return p, pending{}
+	}
+
+	var wait pending
+	wait.kat500Frequency, p.kat500Frequency = p.kat500Frequency, false
+	wait.kpa500Band, p.kpa500Band = p.kpa500Band, false
+
+	if wait.kpa500Band {
+		if p.rfPower && !controller.c.isRadioRFPowerDecrease() {
+			wait.rfPower, p.rfPower = true, false
+		}
+		if p.kpa500Mode && p.kpa500ModeTo == 1 {
+			wait.kpa500Mode, p.kpa500Mode = true, false
+			wait.kpa500ModeTo, p.kpa500ModeTo = p.kpa500ModeTo, 0
+		}
+	}
+
+	return p, wait
+}
+
+// heldKPA500Mode returns the mode a switch held while transmitting is to, false if there isn't one
+func (m *monitor) heldKPA500Mode() (int, bool) {
+	m.mutexPending.Lock()
+	defer m.mutexPending.Unlock()
+
+	return m.pending.kpa500ModeTo, m.pending.kpa500Mode
+}
+
+// isPending returns true if there are changes waiting to be sent to the devices that can be sent now
+func (m *monitor) isPending(settled bool) bool {
+	m.mutexPending.Lock()
+	defer m.mutexPending.Unlock()
+
+	p, _ := m.pending.due(settled)
+
+	return p != pending{}
+}
+
+// applyPending sends the changes waiting for the devices that can be sent now, from our internal state
+func (m *monitor) applyPending(settled bool) {
+	m.mutexPending.Lock()
+	var p pending
+	p, m.pending = m.pending.due(settled)
+	m.mutexPending.Unlock()
+
+	// update kat500 frequency
+	if p.kat500Frequency && !controller.kat500.isReconnecting() {
+		err := controller.c.updateKAT500Frequency(false)
 		if err != nil {
-			status.SetStatus(status.SystemStatusRadio, status.StatusFailed)
-			status.SetStatus(status.SystemStatusKAT500, status.StatusFailed)
-			status.SetStatus(status.SystemStatusKPA500, status.StatusFailed)
-		} else {
-			status.SetStatus(status.SystemStatusRadio, status.StatusOK)
-			status.SetStatus(status.SystemStatusKAT500, status.StatusOK)
-			status.SetStatus(status.SystemStatusKPA500, status.StatusOK)
+			log.Printf("%+v", err)
+			controller.kat500.failed(err)
 		}
-	}()
+	}
 
-	var f int64
+	// update kpa500 band
+	if p.kpa500Band && !controller.kpa500.isReconnecting() {
+		err := controller.c.updateKPA500Band()
+		if err != nil {
+			log.Printf("%+v", err)
+			controller.kpa500.failed(err)
+		}
+	}
+
+	// switch kpa500 mode, which sets the radio rf power & tuner for it too
+	if p.kpa500Mode {
+		p.rfPower = false
+		p.radioATU = false
+
+		// the shared state still has the mode the kpa500 is in
+		err := controller.c.switchKPA500Mode(p.kpa500ModeTo, data.GetKPA500Data().Mode)
+		if err != nil {
+			log.Printf("%+v", err)
+		}
+	}
+
+	// update radio rf power
+	if p.rfPower {
+		err := controller.c.updateRadioRFPower()
+		if err != nil {
+			log.Printf("%+v", err)
+			controller.radio.failed(err)
+		}
+	}
+
+	// update radio tuner
+	if p.radioATU {
+		err := controller.c.updateRadioATU()
+		if err != nil {
+			log.Printf("%+v", err)
+			controller.radio.failed(err)
+		}
+	}
+}
+
+// initializeRadio gets the current frequency from the radio and brings the other devices & radio rf power in line with it
+func (m *monitor) initializeRadio() error {
+	var (
+		f   int64
+		err error
+	)
+
+	deadline := time.Now().Add(radioFrequencyTimeout)
 	for {
 		f, err = m.r.GetFrequency()
-		if err != nil {
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, device.ErrTimeout) || time.Now().After(deadline) {
 			log.Printf("%+v", err)
 			return err
 		}
-		if f > -1 {
-			break
+	}
+
+	// update shared state
+	update := data.UnchangedRadio()
+	update.Frequency = f
+	update.Update()
+
+	// get current mode
+	_, err = m.updateRadioMode()
+	if err != nil {
+		log.Printf("%+v", err)
+		return err
+	}
+
+	// where will the radio transmit?
+	tx, err := m.readRadioTransmitting()
+	if err != nil {
+		log.Printf("%+v", err)
+		return err
+	}
+
+	txf := f
+	if !tx {
+		txf, err = m.readRadioSplit(f)
+		if err != nil {
+			log.Printf("%+v", err)
+			return err
 		}
 	}
 
 	var b int
-	b, err = util.BandFromFrequency(f)
+	b, err = util.BandFromFrequency(txf)
 	if err != nil {
 		log.Printf("%+v", err)
 		return err
 	}
 
-	// update our state
-	m.freq = f
-	m.band = b
-
-	// update shared state
-	data.Radio{
-		Frequency: m.freq,
-		Band:      m.band,
-	}.Update()
+	update = data.UnchangedRadio()
+	update.TXFrequency = txf
+	update.Band = b
+	update.Update()
+
+	// wait for the radio to go back to receive before changing anything
+	if tx {
+		m.hold(pending{
+			kat500Frequency: true,
+			kpa500Band:      true,
+			rfPower:         true,
+			radioATU:        true,
+		})
+		return nil
+	}
 
 	//
 	// now get the other devices to match our internal state
 	//
 
 	// set kat500 frequency
-	err = controller.c.updateKAT500Frequency()
+	if !controller.kat500.isReconnecting() {
+		err = m.initializeKAT500()
+		if err != nil {
+			log.Printf("%+v", err)
+			controller.kat500.failed(err)
+		}
+	}
+
+	// set kpa500 band
+	if !controller.kpa500.isReconnecting() {
+		err = controller.c.updateKPA500Band()
+		if err != nil {
+			log.Printf("%+v", err)
+			controller.kpa500.failed(err)
+		}
+	}
+
+	// set radio rf power
+	err = controller.c.updateRadioRFPower()
 	if err != nil {
 		log.Printf("%+v", err)
 		return err
 	}
 
-	// set kpa500 mode
-	err = controller.c.updateKPA500Mode()
+	// set radio tuner
+	err = controller.c.updateRadioATU()
 	if err != nil {
 		log.Printf("%+v", err)
 		return err
 	}
 
-	// set kpa500 band
-	err = controller.c.updateKPA500Band()
+	return nil
+}
+
+// updateRadioMode updates the shared state with the radio's operating mode if it has changed
+// returns true if the change moved the radio to a different mode group, which can have its own rf power
+func (m *monitor) updateRadioMode() (bool, error) {
+	md, err := m.r.GetMode()
+	if err != nil {
+		// radio only sends its mode when it changes, or can't tell us
+		if errors.Is(err, device.ErrTimeout) || errors.Is(err, device.ErrNotSupported) {
+			return false, nil
+		}
+		log.Printf("%+v", err)
+		return false, err
+	}
+
+	dm := 0
+	if md.Data {
+		dm = 1
+	}
+
+	rd := data.GetRadioData()
+	changed := util.ModeGroup(md.Mode, md.Data) != util.ModeGroup(rd.Mode, rd.DataMode == 1)
+
+	update := data.UnchangedRadio()
+	update.Mode = md.Mode
+	update.Filter = md.Filter
+	update.DataMode = dm
+	update.Update()
+
+	return changed, nil
+}
+
+// initializeKAT500 makes sure the KAT500 is answering and consistent with our internal state
+func (m *monitor) initializeKAT500() error {
+	// make sure something is listening
+	_, err := controller.c.getKAT500InFault()
 	if err != nil {
 		log.Printf("%+v", err)
 		return err
 	}
 
-	// set radio rf power
-	err = controller.c.updateRadioRFPower()
+	// nothing to follow until the radio has reported a frequency
+	if data.GetRadioData().TXFrequency == 0 {
+		return nil
+	}
+
+	// set kat500 frequency, it may have been changed while we weren't talking to it
+	err = controller.c.updateKAT500Frequency(true)
+	if err != nil {
+		log.Printf("%+v", err)
+		return err
+	}
+
+	return nil
+}
+
+// initializeKPA500 makes sure the KPA500 is answering and consistent with our internal state
+func (m *monitor) initializeKPA500() error {
+	// make sure something is listening
+	_, err := controller.c.getKPA500InFault()
+	if err != nil {
+		log.Printf("%+v", err)
+		return err
+	}
+
+	// set kpa500 mode
+	err = controller.c.updateKPA500Mode()
+	if err != nil {
+		log.Printf("%+v", err)
+		return err
+	}
+
+	// nothing more until the radio has reported a frequency
+	if data.GetRadioData().Band == 0 {
+		return nil
+	}
+
+	// set kpa500 band
+	err = controller.c.updateKPA500Band()
 	if err != nil {
 		log.Printf("%+v", err)
 		return err
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bbathe/icom-powercombo-controller/device"
+	"github.com/bbathe/icom-powercombo-controller/status"
+	"github.com/bbathe/icom-powercombo-controller/util"
+)
+
+var (
+	// how long to wait before reconnecting, doubles after each failed attempt up to the max
+	reconnectBackoffMin = 1 * time.Second
+	reconnectBackoffMax = 30 * time.Second
+)
+
+// supervisor watches over the connection to a device and reconnects when communication fails
+type supervisor struct {
+	system status.SystemStatus
+
+	// reopen closes & opens the connection(s) to the device, initialize brings the device in line with our state
+	reopen     func() error
+	initialize func() error
+
+	reconnecting util.AtomFlag
+
+	mutexAttempt sync.Mutex
+	quit         chan bool
+}
+
+func newSupervisor(system status.SystemStatus, reopen func() error, initialize func() error) *supervisor {
+	return &supervisor{
+		system:     system,
+		reopen:     reopen,
+		initialize: initialize,
+		quit:       make(chan bool),
+	}
+}
+
+// close stops any reconnecting, returns after an attempt in progress finishes
+func (s *supervisor) close() {
+	close(s.quit)
+
+	s.mutexAttempt.Lock()
+	defer s.mutexAttempt.Unlock()
+}
+
+// connect makes the first connection to the device, reconnecting in the background if that fails
+func (s *supervisor) connect() {
+	s.reconnecting.Set(true)
+
+	err := s.attempt()
+	if err != nil {
+		log.Printf("%+v", err)
+		status.SetStatus(s.system, status.StatusFailed)
+		go s.reconnect()
+		return
+	}
+
+	status.SetStatus(s.system, status.StatusOK)
+	s.reconnecting.Set(false)
+}
+
+// isReconnecting returns true while the connection to the device is being reestablished
+func (s *supervisor) isReconnecting() bool {
+	return s.reconnecting.IsTrue()
+}
+
+// failed is called when communication with the device fails, starts reconnecting if not already
+func (s *supervisor) failed(err error) {
+	// port was closed out from under us by a reconnect or shutdown, not a failure of the device
+	if errors.Is(err, device.ErrPortClosed) {
+		return
+	}
+
+	if !s.reconnecting.CompareAndSet(false, true) {
+		return
+	}
+
+	log.Printf("%s failed, reconnecting: %+v", s.system, err)
+	status.SetStatus(s.system, status.StatusFailed)
+
+	go s.reconnect()
+}
+
+// reconnect reopens the connection to the device with exponential backoff until it succeeds or the supervisor is closed
+func (s *supervisor) reconnect() {
+	defer s.reconnecting.Set(false)
+
+	backoff := reconnectBackoffMin
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(backoff):
+		}
+
+		err := s.attempt()
+		if err == nil {
+			// closed while attempting?
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+
+			log.Printf("%s reconnected", s.system)
+			status.SetStatus(s.system, status.StatusOK)
+			return
+		}
+		log.Printf("%+v", err)
+
+		backoff *= 2
+		if backoff > reconnectBackoffMax {
+			backoff = reconnectBackoffMax
+		}
+	}
+}
+
+// attempt reopens & initializes the device, unless the supervisor has been closed
+func (s *supervisor) attempt() error {
+	s.mutexAttempt.Lock()
+	defer s.mutexAttempt.Unlock()
+
+	select {
+	case <-s.quit:
+		return nil
+	default:
+	}
+
+	err := s.reopen()
+	if err != nil {
+		return err
+	}
+
+	return s.initialize()
+}
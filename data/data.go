@@ -5,8 +5,33 @@ import (
 )
 
 type Radio struct {
-	Frequency int64
-	Band      int
+	// Frequency is the operating (receive) frequency, TXFrequency where the radio transmits, which differs when split
+	// Band is the band of TXFrequency, that's the band the KPA500 & KAT500 need to be on
+	Frequency   int64
+	TXFrequency int64
+	Band        int
+
+	// Split is 1 while split is on, SubBand is 1 while the sub band is selected on radios with main & sub bands
+	// those radios transmit on the main band, or on the sub band when split, others on the unselected vfo when split
+	Split   int
+	SubBand int
+
+	// operating mode, e.g. USB or CW, the filter selected (1-3) and whether data mode is on (0/1)
+	Mode     string
+	Filter   int
+	DataMode int
+
+	// rf power level (0-255) read back from the radio
+	RFPower int
+
+	// 1 while the radio is transmitting
+	Transmitting int
+
+	// meters read while transmitting: rf output (percent of full power), SWR, ALC (percent of the ALC zone) & PA drain current (amps)
+	Po  float64
+	SWR float64
+	ALC float64
+	Id  float64
 }
 
 type KPA500 struct {
@@ -67,8 +92,27 @@ func publishDataChange() {
 	}
 }
 
+// UnchangedRadio returns a Radio that doesn't update anything, set the fields that changed on it before calling Update
+func UnchangedRadio() Radio {
+	return Radio{
+		Frequency:    -1,
+		TXFrequency:  -1,
+		Band:         -1,
+		Split:        -1,
+		SubBand:      -1,
+		Filter:       -1,
+		DataMode:     -1,
+		RFPower:      -1,
+		Transmitting: -1,
+		Po:           -1,
+		SWR:          -1,
+		ALC:          -1,
+		Id:           -1,
+	}
+}
+
 // update shared state about the Radio
-// pass -1 for any data that shouldn't be updated
+// pass -1 (or "" for Mode) for any data that shouldn't be updated
 func (rd Radio) Update() {
 	mutexData.Lock()
 	defer mutexData.Unlock()
@@ -76,9 +120,45 @@ func (rd Radio) Update() {
 	if rd.Frequency > -1 {
 		radio.Frequency = rd.Frequency
 	}
+	if rd.TXFrequency > -1 {
+		radio.TXFrequency = rd.TXFrequency
+	}
 	if rd.Band > -1 {
 		radio.Band = rd.Band
 	}
+	if rd.Split > -1 {
+		radio.Split = rd.Split
+	}
+	if rd.SubBand > -1 {
+		radio.SubBand = rd.SubBand
+	}
+	if rd.Mode != "" {
+		radio.Mode = rd.Mode
+	}
+	if rd.Filter > -1 {
+		radio.Filter = rd.Filter
+	}
+	if rd.DataMode > -1 {
+		radio.DataMode = rd.DataMode
+	}
+	if rd.RFPower > -1 {
+		radio.RFPower = rd.RFPower
+	}
+	if rd.Transmitting > -1 {
+		radio.Transmitting = rd.Transmitting
+	}
+	if rd.Po > -1 {
+		radio.Po = rd.Po
+	}
+	if rd.SWR > -1 {
+		radio.SWR = rd.SWR
+	}
+	if rd.ALC > -1 {
+		radio.ALC = rd.ALC
+	}
+	if rd.Id > -1 {
+		radio.Id = rd.Id
+	}
 
 	publishDataChange()
 }
@@ -135,3 +215,24 @@ func GetKPA500Data() KPA500 {
 	kpa := kpa500
 	return kpa
 }
+
+// GetKAT500Data returns a consistent copy of the current KAT500 shared state
+func GetKAT500Data() KAT500 {
+	mutexData.Lock()
+	defer mutexData.Unlock()
+
+	kat := kat500
+	return kat
+}
+
+// GetData returns a consistent copy of all the current shared state
+func GetData() Data {
+	mutexData.Lock()
+	defer mutexData.Unlock()
+
+	return Data{
+		Radio:  radio,
+		KPA500: kpa500,
+		KAT500: kat500,
+	}
+}
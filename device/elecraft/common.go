@@ -2,12 +2,20 @@ package elecraft
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
 
-	"github.com/albenik/go-serial/v2"
+	"github.com/bbathe/icom-powercombo-controller/device"
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+	"github.com/bbathe/icom-powercombo-controller/util"
 )
 
 // readMessageFromPort reads a KPA500/KAT500 formatted message from port p
-func readMessageFromPort(p *serial.Port) (string, error) {
+func readMessageFromPort(p transport.Transport) (string, error) {
+	if p == nil {
+		return "", device.ErrPortClosed
+	}
+
 	var buf bytes.Buffer
 	b := []byte{0}
 
@@ -35,7 +43,11 @@ func readMessageFromPort(p *serial.Port) (string, error) {
 }
 
 // writeMessageToPort writes a KPA500/KAT500 formatted message to port p
-func writeMessageToPort(p *serial.Port, msg string) error {
+func writeMessageToPort(p transport.Transport, msg string) error {
+	if p == nil {
+		return device.ErrPortClosed
+	}
+
 	// write to port
 	_, err := p.Write([]byte(msg))
 	if err != nil {
@@ -44,3 +56,52 @@ func writeMessageToPort(p *serial.Port, msg string) error {
 
 	return nil
 }
+
+// command writes msg to port p, for commands that have no response
+func command(p transport.Transport, closed *util.AtomFlag, msg string) error {
+	err := writeMessageToPort(p, msg)
+	if closed.IsTrue() {
+		return device.ErrPortClosed
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// request writes msg to port p and reads messages until one starts with prefix, returns what follows prefix without the terminator
+func request(p transport.Transport, closed *util.AtomFlag, msg string, prefix string) (string, error) {
+	err := command(p, closed, msg)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		rsp, err := readMessageFromPort(p)
+		if closed.IsTrue() {
+			return "", device.ErrPortClosed
+		}
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasSuffix(rsp, ";") {
+			// no (complete) response, disconnected?
+			return "", device.ErrTimeout
+		}
+		if rsp == "?;" {
+			// device didn't like the command
+			return "", fmt.Errorf("%w: %s", device.ErrDeviceRejected, msg)
+		}
+
+		// our response?
+		if strings.HasPrefix(rsp, prefix) {
+			s := strings.TrimSuffix(strings.TrimPrefix(rsp, prefix), ";")
+			if len(s) == 0 {
+				return "", fmt.Errorf("%w: %q", device.ErrMalformedResponse, rsp)
+			}
+
+			return s, nil
+		}
+	}
+}
@@ -6,39 +6,75 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/bbathe/icom-powercombo-controller/device"
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
 	"github.com/bbathe/icom-powercombo-controller/util"
-
-	"github.com/albenik/go-serial/v2"
 )
 
+// how long a full tune can take, the KAT500 answers once it's done
+var fullTuneTimeout = 10 * time.Second
+
 type KAT500 struct {
-	Port string
-	Baud int
+	Transport string
+	Port      string
+	Baud      int
 
-	p         *serial.Port
+	p         transport.Transport
 	mutexPort sync.Mutex
 	closed    util.AtomFlag
 }
 
+// NewKAT500 creates a KAT500 that is not yet connected, call Reopen to connect
+// kind selects the transport, port is the address of the device on that transport
+func NewKAT500(kind string, port string, baud int) *KAT500 {
+	k := new(KAT500)
+	k.Transport = kind
+	k.Port = port
+	k.Baud = baud
+	k.closed.Set(true)
+
+	return k
+}
+
 // OpenKAT500 creates a connection with the KAT500
-func OpenKAT500(port string, baud int) (*KAT500, error) {
-	p, err := serial.Open(port,
-		serial.WithBaudrate(baud),
-		serial.WithReadTimeout(333),
-		serial.WithWriteTimeout(333),
-	)
+// kind selects the transport, port is the address of the device on that transport
+func OpenKAT500(kind string, port string, baud int) (*KAT500, error) {
+	k := NewKAT500(kind, port, baud)
+
+	err := k.Reopen()
 	if err != nil {
 		log.Printf("%+v", err)
 		return nil, err
 	}
 
-	k := new(KAT500)
+	return k, nil
+}
+
+// Reopen closes the connection with the KAT500, if there is one, and connects again
+func (k *KAT500) Reopen() error {
+	// make anything waiting on the port give up
+	k.closed.Set(true)
+
+	k.mutexPort.Lock()
+	defer k.mutexPort.Unlock()
+
+	if k.p != nil {
+		_ = k.p.Close()
+		k.p = nil
+	}
+
+	p, err := transport.Open(k.Transport, k.Port, k.Baud)
+	if err != nil {
+		log.Printf("%+v", err)
+		return err
+	}
+
 	k.p = p
-	k.Port = port
-	k.Baud = baud
+	k.closed.Set(false)
 
-	return k, nil
+	return nil
 }
 
 // Close closes the connection with the KAT500
@@ -48,6 +84,10 @@ func (k *KAT500) Close() error {
 	k.mutexPort.Lock()
 	defer k.mutexPort.Unlock()
 
+	if k.p == nil {
+		return nil
+	}
+
 	return k.p.Close()
 }
 
@@ -56,10 +96,7 @@ func (k *KAT500) SetFrequency(freq int64) error {
 	k.mutexPort.Lock()
 	defer k.mutexPort.Unlock()
 
-	err := writeMessageToPort(k.p, fmt.Sprintf("F %d;", freq/1000))
-	if k.closed.IsTrue() {
-		return nil
-	}
+	err := command(k.p, &k.closed, fmt.Sprintf("F %d;", freq/1000))
 	if err != nil {
 		log.Printf("%+v", err)
 		return err
@@ -74,51 +111,22 @@ func (k *KAT500) GetFault() (int, error) {
 	defer k.mutexPort.Unlock()
 
 	// request current fault
-	err := writeMessageToPort(k.p, "FLT;")
-	if k.closed.IsTrue() {
-		return 0, nil
-	}
+	// RSP format: FLTc;
+	s, err := request(k.p, &k.closed, "FLT;", "FLT")
 	if err != nil {
 		log.Printf("%+v", err)
 		return 0, err
 	}
 
-	// read response from kat500
-	for {
-		msg, err := readMessageFromPort(k.p)
-		if k.closed.IsTrue() {
-			return 0, nil
-		}
-		if err != nil {
-			log.Printf("%+v", err)
-			return 0, err
-		}
-		if msg == "" {
-			// no response, kat500 disconnected?
-			return 255, nil
-		}
-
-		// our response?
-		if strings.HasPrefix(msg, "FLT") {
-			// RSP format: FLTc;
-			s := strings.TrimPrefix(msg, "FLT")
-			s = strings.TrimSuffix(s, ";")
-
-			if len(s) == 0 {
-				// no response, kat500 disconnected?
-				return 255, nil
-			}
-
-			// convert to number
-			fault, err := strconv.Atoi(s)
-			if err != nil {
-				log.Printf("%+v", err)
-				return 0, err
-			}
-
-			return fault, nil
-		}
+	// convert to number
+	fault, err := strconv.Atoi(s)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", device.ErrMalformedResponse, err)
+		log.Printf("%+v", err)
+		return 0, err
 	}
+
+	return fault, nil
 }
 
 // GetVSWR gets the currentVoltage Standing Wave Ratio from the KAT500
@@ -127,81 +135,61 @@ func (k *KAT500) GetVSWR() (float64, error) {
 	defer k.mutexPort.Unlock()
 
 	// request current VSWR
-	err := writeMessageToPort(k.p, "VSWR;")
-	if k.closed.IsTrue() {
-		return 0, nil
-	}
+	// RSP format: VSWR nn.nn;
+	s, err := request(k.p, &k.closed, "VSWR;", "VSWR ")
 	if err != nil {
 		log.Printf("%+v", err)
 		return 0, err
 	}
 
-	// read response from kat500
-	for {
-		msg, err := readMessageFromPort(k.p)
-		if k.closed.IsTrue() {
-			return 0, nil
-		}
-		if err != nil {
-			log.Printf("%+v", err)
-			return 0, err
-		}
-		if msg == "" {
-			// no response, kat500 disconnected?
-			return 0, nil
-		}
-
-		// our response?
-		if strings.HasPrefix(msg, "VSWR") {
-			// RSP format: VSWR nn.nn;
-			s := strings.TrimPrefix(msg, "VSWR ")
-			s = strings.TrimSuffix(s, ";")
-
-			if len(s) == 0 {
-				// no response, kat500 disconnected?
-				return 0, nil
-			}
-
-			// convert to number
-			vswr, err := strconv.ParseFloat(s, 64)
-			if err != nil {
-				log.Printf("%+v", err)
-				return 0, err
-			}
-
-			return vswr, nil
-		}
+	// convert to number
+	vswr, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", device.ErrMalformedResponse, err)
+		log.Printf("%+v", err)
+		return 0, err
 	}
+
+	return vswr, nil
 }
 
+// FullTune initiates a full tune and waits for it to finish
 func (k *KAT500) FullTune() error {
 	k.mutexPort.Lock()
 	defer k.mutexPort.Unlock()
 
 	// request full tune
-	err := writeMessageToPort(k.p, "T;")
-	if k.closed.IsTrue() {
-		return nil
-	}
+	// RSP format: FT;
+	err := command(k.p, &k.closed, "T;")
 	if err != nil {
 		log.Printf("%+v", err)
 		return err
 	}
 
-	// read response from kat500
+	// read response from kat500, reads time out long before a tune is done
+	deadline := time.Now().Add(fullTuneTimeout)
+	var partial string
 	for {
 		msg, err := readMessageFromPort(k.p)
 		if k.closed.IsTrue() {
-			return nil
+			return device.ErrPortClosed
 		}
 		if err != nil {
 			log.Printf("%+v", err)
 			return err
 		}
-		if msg == "" {
-			// no response, kat500 disconnected?
-			return nil
+
+		msg = partial + msg
+		if !strings.HasSuffix(msg, ";") {
+			// no (complete) response yet, kat500 disconnected?
+			if time.Now().After(deadline) {
+				log.Printf("%+v", device.ErrTimeout)
+				return device.ErrTimeout
+			}
+			partial = msg
+			continue
 		}
+		partial = ""
 
 		// our response?
 		if msg == "FT;" {
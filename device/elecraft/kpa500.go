@@ -7,16 +7,17 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/bbathe/icom-powercombo-controller/device"
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
 	"github.com/bbathe/icom-powercombo-controller/util"
-
-	"github.com/albenik/go-serial/v2"
 )
 
 type KPA500 struct {
-	Port string
-	Baud int
+	Transport string
+	Port      string
+	Baud      int
 
-	p         *serial.Port
+	p         transport.Transport
 	mutexPort sync.Mutex
 	closed    util.AtomFlag
 }
@@ -38,24 +39,55 @@ var (
 	}
 )
 
+// NewKPA500 creates a KPA500 that is not yet connected, call Reopen to connect
+// kind selects the transport, port is the address of the device on that transport
+func NewKPA500(kind string, port string, baud int) *KPA500 {
+	k := new(KPA500)
+	k.Transport = kind
+	k.Port = port
+	k.Baud = baud
+	k.closed.Set(true)
+
+	return k
+}
+
 // OpenKPA500 creates a connection with the KPA500
-func OpenKPA500(port string, baud int) (*KPA500, error) {
-	p, err := serial.Open(port,
-		serial.WithBaudrate(baud),
-		serial.WithReadTimeout(333),
-		serial.WithWriteTimeout(333),
-	)
+// kind selects the transport, port is the address of the device on that transport
+func OpenKPA500(kind string, port string, baud int) (*KPA500, error) {
+	k := NewKPA500(kind, port, baud)
+
+	err := k.Reopen()
 	if err != nil {
 		log.Printf("%+v", err)
 		return nil, err
 	}
 
-	k := new(KPA500)
+	return k, nil
+}
+
+// Reopen closes the connection with the KPA500, if there is one, and connects again
+func (k *KPA500) Reopen() error {
+	// make anything waiting on the port give up
+	k.closed.Set(true)
+
+	k.mutexPort.Lock()
+	defer k.mutexPort.Unlock()
+
+	if k.p != nil {
+		_ = k.p.Close()
+		k.p = nil
+	}
+
+	p, err := transport.Open(k.Transport, k.Port, k.Baud)
+	if err != nil {
+		log.Printf("%+v", err)
+		return err
+	}
+
 	k.p = p
-	k.Port = port
-	k.Baud = baud
+	k.closed.Set(false)
 
-	return k, nil
+	return nil
 }
 
 // Close closes the connection with the KPA500
@@ -65,6 +97,10 @@ func (k *KPA500) Close() error {
 	k.mutexPort.Lock()
 	defer k.mutexPort.Unlock()
 
+	if k.p == nil {
+		return nil
+	}
+
 	return k.p.Close()
 }
 
@@ -73,10 +109,7 @@ func (k *KPA500) SetMode(mode int) error {
 	k.mutexPort.Lock()
 	defer k.mutexPort.Unlock()
 
-	err := writeMessageToPort(k.p, fmt.Sprintf("^OS%d;", mode))
-	if k.closed.IsTrue() {
-		return nil
-	}
+	err := command(k.p, &k.closed, fmt.Sprintf("^OS%d;", mode))
 	if err != nil {
 		log.Printf("%+v", err)
 		return err
@@ -90,10 +123,14 @@ func (k *KPA500) SetBand(band int) error {
 	k.mutexPort.Lock()
 	defer k.mutexPort.Unlock()
 
-	err := writeMessageToPort(k.p, fmt.Sprintf("^BN%s;", bandLookup[band]))
-	if k.closed.IsTrue() {
-		return nil
+	b, ok := bandLookup[band]
+	if !ok {
+		err := fmt.Errorf("KPA500 does not cover %dm", band)
+		log.Printf("%+v", err)
+		return err
 	}
+
+	err := command(k.p, &k.closed, fmt.Sprintf("^BN%s;", b))
 	if err != nil {
 		log.Printf("%+v", err)
 		return err
@@ -108,54 +145,25 @@ func (k *KPA500) GetPower() (int, error) {
 	defer k.mutexPort.Unlock()
 
 	// request power
-	err := writeMessageToPort(k.p, "^WS;")
-	if k.closed.IsTrue() {
-		return 0, nil
-	}
+	// RSP format: ^WSppp sss;
+	s, err := request(k.p, &k.closed, "^WS;", "^WS")
 	if err != nil {
 		log.Printf("%+v", err)
 		return 0, err
 	}
 
-	// read response from kpa500
-	for {
-		msg, err := readMessageFromPort(k.p)
-		if k.closed.IsTrue() {
-			return 0, nil
-		}
-		if err != nil {
-			log.Printf("%+v", err)
-			return 0, err
-		}
-		if msg == "" {
-			// no response, kpa500 disconnected?
-			return 0, nil
-		}
-
-		// our response?
-		if strings.HasPrefix(msg, "^WS") {
-			// RSP format: ^WSppp sss;
-			s := strings.TrimPrefix(msg, "^WS")
-			s = strings.TrimSuffix(s, ";")
-
-			if len(s) == 0 {
-				// no response, kpa500 disconnected?
-				return 0, nil
-			}
-
-			ss := strings.Split(s, " ")
-			w := ss[0]
-
-			// convert to number
-			watts, err := strconv.Atoi(w)
-			if err != nil {
-				log.Printf("%+v", err)
-				return 0, err
-			}
-
-			return watts, nil
-		}
+	ss := strings.Split(s, " ")
+	w := ss[0]
+
+	// convert to number
+	watts, err := strconv.Atoi(w)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", device.ErrMalformedResponse, err)
+		log.Printf("%+v", err)
+		return 0, err
 	}
+
+	return watts, nil
 }
 
 // GetFault gets the current fault identifier from the KPA500, zero indicates no faults are active
@@ -164,51 +172,22 @@ func (k *KPA500) GetFault() (int, error) {
 	defer k.mutexPort.Unlock()
 
 	// request current fault
-	err := writeMessageToPort(k.p, "^FL;")
-	if k.closed.IsTrue() {
-		return 0, nil
-	}
+	// RSP format: ^FLnn;
+	s, err := request(k.p, &k.closed, "^FL;", "^FL")
 	if err != nil {
 		log.Printf("%+v", err)
 		return 0, err
 	}
 
-	// read response from kpa500
-	for {
-		msg, err := readMessageFromPort(k.p)
-		if k.closed.IsTrue() {
-			return 0, nil
-		}
-		if err != nil {
-			log.Printf("%+v", err)
-			return 0, err
-		}
-		if msg == "" {
-			// no response, kpa500 disconnected?
-			return 255, nil
-		}
-
-		// our response?
-		if strings.HasPrefix(msg, "^FL") {
-			// RSP format: ^FLnn;
-			s := strings.TrimPrefix(msg, "^FL")
-			s = strings.TrimSuffix(s, ";")
-
-			if len(s) == 0 {
-				// no response, kpa500 disconnected?
-				return 255, nil
-			}
-
-			// convert to number
-			fault, err := strconv.Atoi(s)
-			if err != nil {
-				log.Printf("%+v", err)
-				return 0, err
-			}
-
-			return fault, nil
-		}
+	// convert to number
+	fault, err := strconv.Atoi(s)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", device.ErrMalformedResponse, err)
+		log.Printf("%+v", err)
+		return 0, err
 	}
+
+	return fault, nil
 }
 
 // GetPAVoltsCurrent gets the PA Voltage and Current from the KPA500
@@ -217,58 +196,35 @@ func (k *KPA500) GetPAVoltsCurrent() (float64, float64, error) {
 	defer k.mutexPort.Unlock()
 
 	// request pa volts & current
-	err := writeMessageToPort(k.p, "^VI;")
-	if k.closed.IsTrue() {
-		return 0.0, 0.0, nil
-	}
+	// RSP format:  ^VIvvv iii; where vvv = the PA voltage with range 00.0 - 99.9 volts, and iii = PA current with range of 00.0 - 99.9 amps
+	s, err := request(k.p, &k.closed, "^VI;", "^VI")
 	if err != nil {
 		log.Printf("%+v", err)
-		return 0.0, 0.0, nil
+		return 0.0, 0.0, err
+	}
+
+	ss := strings.Split(s, " ")
+	if len(ss) != 2 || len(ss[0]) != 3 || len(ss[1]) != 3 {
+		err = fmt.Errorf("%w: %q", device.ErrMalformedResponse, s)
+		log.Printf("%+v", err)
+		return 0.0, 0.0, err
 	}
+	v := ss[0][:2] + "." + ss[0][2:]
+	a := ss[1][:2] + "." + ss[1][2:]
 
-	// read response from kpa500
-	for {
-		msg, err := readMessageFromPort(k.p)
-		if k.closed.IsTrue() {
-			return 0.0, 0.0, nil
-		}
-		if err != nil {
-			log.Printf("%+v", err)
-			return 0.0, 0.0, nil
-		}
-		if msg == "" {
-			// no response, kpa500 disconnected?
-			return 0.0, 0.0, nil
-		}
-
-		// our response?
-		if strings.HasPrefix(msg, "^VI") {
-			// RSP format:  ^VIvvv iii; where vvv = the PA voltage with range 00.0 - 99.9 volts, and iii = PA current with range of 00.0 - 99.9 amps
-			s := strings.TrimPrefix(msg, "^VI")
-			s = strings.TrimSuffix(s, ";")
-
-			if len(s) == 0 {
-				// no response, kpa500 disconnected?
-				return 0.0, 0.0, nil
-			}
-
-			ss := strings.Split(s, " ")
-			v := ss[0][:2] + "." + ss[0][2:]
-			a := ss[1][:2] + "." + ss[1][2:]
-
-			// convert to floats
-			volts, err := strconv.ParseFloat(v, 64)
-			if err != nil {
-				log.Printf("%+v", err)
-				return 0.0, 0.0, nil
-			}
-			amps, err := strconv.ParseFloat(a, 64)
-			if err != nil {
-				log.Printf("%+v", err)
-				return 0.0, 0.0, nil
-			}
-
-			return volts, amps, nil
-		}
+	// convert to floats
+	volts, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", device.ErrMalformedResponse, err)
+		log.Printf("%+v", err)
+		return 0.0, 0.0, err
 	}
+	amps, err := strconv.ParseFloat(a, 64)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", device.ErrMalformedResponse, err)
+		log.Printf("%+v", err)
+		return 0.0, 0.0, err
+	}
+
+	return volts, amps, nil
 }
@@ -0,0 +1,56 @@
+package sim
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+)
+
+// TraceFunc is called with every command an emulator receives
+type TraceFunc func(cmd string)
+
+// conn is one connection from a controller to an emulated device
+type conn struct {
+	t          transport.Transport
+	mutexWrite sync.Mutex
+}
+
+// reply writes msg back to the controller
+func (c *conn) reply(msg string) {
+	c.mutexWrite.Lock()
+	defer c.mutexWrite.Unlock()
+
+	_, _ = c.t.Write([]byte(msg))
+}
+
+// serve reads ';' terminated commands from t and passes them to trace & handle until t is closed
+func serve(t transport.Transport, trace func() TraceFunc, handle func(c *conn, cmd string)) error {
+	c := &conn{t: t}
+
+	var buf bytes.Buffer
+	b := make([]byte, 64)
+
+	for {
+		n, err := t.Read(b)
+		if err != nil {
+			if err == io.EOF || err == transport.ErrClosed {
+				return nil
+			}
+			return err
+		}
+
+		for _, ch := range b[:n] {
+			if ch == ';' {
+				if tf := trace(); tf != nil {
+					tf(buf.String())
+				}
+				handle(c, buf.String())
+				buf.Reset()
+				continue
+			}
+			buf.WriteByte(ch)
+		}
+	}
+}
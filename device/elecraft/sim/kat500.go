@@ -0,0 +1,323 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+)
+
+// KAT500 fault codes, from the KAT500 documentation
+const (
+	KAT500FaultNone = iota
+	KAT500FaultNoMatch
+	KAT500FaultPowerAboveDesignLimit
+	KAT500FaultPowerAboveRelayLimit
+	KAT500FaultSWRAboveThreshold
+)
+
+// SWRFunc returns the unmatched SWR of antenna at freq (in kHz)
+type SWRFunc func(antenna int, freq int64) float64
+
+type memoryKey struct {
+	antenna int
+	segment int64
+}
+
+// KAT500 emulates the Elecraft KAT500 antenna tuner
+type KAT500 struct {
+	// TuneTime is how long a full tune takes
+	TuneTime time.Duration
+
+	// SegmentSize is the width, in kHz, of each tuning memory
+	SegmentSize int64
+
+	// MaxMatchSWR is the highest unmatched SWR a tune can match, above this tunes fail with no match
+	MaxMatchSWR float64
+
+	mutex   sync.Mutex
+	trace   TraceFunc
+	swr     SWRFunc
+	freq    int64
+	antenna int
+	mode    string
+	bypass  bool
+	fault   int
+	tuning  bool
+	silent  bool
+	memory  map[memoryKey]float64
+}
+
+// NewKAT500 creates a KAT500 emulator in auto mode on antenna 1, with a flat 1.5:1 antenna
+func NewKAT500() *KAT500 {
+	return &KAT500{
+		TuneTime:    1 * time.Second,
+		SegmentSize: 10,
+		MaxMatchSWR: 10,
+		swr: func(antenna int, freq int64) float64 {
+			return 1.5
+		},
+		freq:    7000,
+		antenna: 1,
+		mode:    "A",
+		memory:  make(map[memoryKey]float64),
+	}
+}
+
+// Serve answers commands from the controller on t until t is closed
+func (k *KAT500) Serve(t transport.Transport) error {
+	return serve(t, k.getTrace, k.handle)
+}
+
+// SetTrace sets a function to be called with every command received
+func (k *KAT500) SetTrace(trace TraceFunc) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.trace = trace
+}
+
+func (k *KAT500) getTrace() TraceFunc {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.trace
+}
+
+// ListenPipe registers the emulator as the in-memory pipe name
+func (k *KAT500) ListenPipe(name string) {
+	transport.RegisterPipe(name, func(t transport.Transport) {
+		_ = k.Serve(t)
+	})
+}
+
+// SetSWR changes the unmatched SWR presented by the antennas
+func (k *KAT500) SetSWR(swr SWRFunc) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.swr = swr
+}
+
+// InjectFault makes the KAT500 report fault until it is cleared
+func (k *KAT500) InjectFault(fault int) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.fault = fault
+}
+
+// ClearFault clears any active fault, same as the FLTC command
+func (k *KAT500) ClearFault() {
+	k.InjectFault(KAT500FaultNone)
+}
+
+// SetSilent stops the KAT500 from responding to any command, like it was powered off or unplugged
+func (k *KAT500) SetSilent(silent bool) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.silent = silent
+}
+
+// Frequency returns the frequency (in kHz) the KAT500 was last set to
+func (k *KAT500) Frequency() int64 {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.freq
+}
+
+// Antenna returns the selected antenna
+func (k *KAT500) Antenna() int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.antenna
+}
+
+// Mode returns the current mode, B(ypass), M(anual) or A(uto)
+func (k *KAT500) Mode() string {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.mode
+}
+
+// Bypassed returns whether the tuner is bypassed
+func (k *KAT500) Bypassed() bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.bypassed()
+}
+
+// Fault returns the active fault, zero for none
+func (k *KAT500) Fault() int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.fault
+}
+
+// Tuning returns whether a full tune is in progress
+func (k *KAT500) Tuning() bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.tuning
+}
+
+// VSWR returns the SWR the KAT500 currently presents to the amplifier
+func (k *KAT500) VSWR() float64 {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.vswr()
+}
+
+func (k *KAT500) bypassed() bool {
+	return k.bypass || k.mode == "B"
+}
+
+func (k *KAT500) key() memoryKey {
+	return memoryKey{antenna: k.antenna, segment: k.freq / k.SegmentSize}
+}
+
+func (k *KAT500) vswr() float64 {
+	if !k.bypassed() {
+		if v, ok := k.memory[k.key()]; ok {
+			return v
+		}
+	}
+
+	return k.swr(k.antenna, k.freq)
+}
+
+// tune runs a full tune, storing the match for the current segment
+func (k *KAT500) tune(c *conn) {
+	k.mutex.Lock()
+	if k.tuning {
+		k.mutex.Unlock()
+		return
+	}
+	k.tuning = true
+	d := k.TuneTime
+	k.mutex.Unlock()
+
+	time.AfterFunc(d, func() {
+		k.mutex.Lock()
+		defer k.mutex.Unlock()
+
+		k.tuning = false
+
+		raw := k.swr(k.antenna, k.freq)
+		if raw > k.MaxMatchSWR {
+			k.fault = KAT500FaultNoMatch
+		} else {
+			// good match, most of the mismatch is gone
+			m := 1.0 + (raw-1.0)*0.05
+			k.memory[k.key()] = m
+			k.bypass = false
+		}
+
+		if !k.silent {
+			c.reply("FT;")
+		}
+	})
+}
+
+// handle answers a single command
+func (k *KAT500) handle(c *conn, cmd string) {
+	k.mutex.Lock()
+	silent := k.silent
+	k.mutex.Unlock()
+	if silent {
+		return
+	}
+
+	switch {
+	case cmd == "T" || cmd == "FT":
+		k.tune(c)
+
+	case cmd == "TP":
+		k.mutex.Lock()
+		t := 0
+		if k.tuning {
+			t = 1
+		}
+		k.mutex.Unlock()
+		c.reply(fmt.Sprintf("TP%d;", t))
+
+	case cmd == "F":
+		c.reply(fmt.Sprintf("F %d;", k.Frequency()))
+
+	case strings.HasPrefix(cmd, "F "):
+		f, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(cmd, "F ")), 10, 64)
+		if err != nil || f <= 0 {
+			c.reply("?;")
+			return
+		}
+		k.mutex.Lock()
+		k.freq = f
+		k.mutex.Unlock()
+
+	case cmd == "FLT":
+		c.reply(fmt.Sprintf("FLT%d;", k.Fault()))
+
+	case cmd == "FLTC":
+		k.ClearFault()
+
+	case cmd == "VSWR":
+		c.reply(fmt.Sprintf("VSWR %.2f;", k.VSWR()))
+
+	case cmd == "AN":
+		c.reply(fmt.Sprintf("AN%d;", k.Antenna()))
+
+	case strings.HasPrefix(cmd, "AN"):
+		a, err := strconv.Atoi(strings.TrimPrefix(cmd, "AN"))
+		if err != nil || a < 1 || a > 3 {
+			c.reply("?;")
+			return
+		}
+		k.mutex.Lock()
+		k.antenna = a
+		k.mutex.Unlock()
+
+	case cmd == "MD":
+		c.reply(fmt.Sprintf("MD%s;", k.Mode()))
+
+	case strings.HasPrefix(cmd, "MD"):
+		m := strings.TrimPrefix(cmd, "MD")
+		if m != "B" && m != "M" && m != "A" {
+			c.reply("?;")
+			return
+		}
+		k.mutex.Lock()
+		k.mode = m
+		k.mutex.Unlock()
+
+	case cmd == "BYP":
+		b := "N"
+		if k.Bypassed() {
+			b = "B"
+		}
+		c.reply(fmt.Sprintf("BYP%s;", b))
+
+	case strings.HasPrefix(cmd, "BYP"):
+		b := strings.TrimPrefix(cmd, "BYP")
+		if b != "B" && b != "N" {
+			c.reply("?;")
+			return
+		}
+		k.mutex.Lock()
+		k.bypass = (b == "B")
+		k.mutex.Unlock()
+
+	default:
+		c.reply("?;")
+	}
+}
@@ -0,0 +1,348 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+)
+
+// KPA500 fault codes, from the KPA500 documentation
+const (
+	KPA500FaultNone            = 0
+	KPA500FaultHighCurrent     = 2
+	KPA500FaultHighTemperature = 4
+	KPA500FaultSupplyVoltage   = 6
+	KPA500FaultHighReflected   = 8
+)
+
+// KPA500 emulates the Elecraft KPA500 amplifier
+type KPA500 struct {
+	// Gain is output watts per watt of drive
+	Gain float64
+
+	// MaxPower is the highest output power, more drive than this needs trips a high current fault
+	MaxPower float64
+
+	// IdleVolts is the PA supply voltage when not transmitting, VoltsSag is how far it drops per output watt
+	IdleVolts float64
+	VoltsSag  float64
+
+	// Efficiency is output power over PA input power
+	Efficiency float64
+
+	// Ambient is the heatsink temperature (C) at rest, MaxTemperature trips a high temperature fault
+	Ambient        float64
+	MaxTemperature float64
+
+	mutex        sync.Mutex
+	trace        TraceFunc
+	mode         int
+	band         string
+	drive        float64
+	transmitting bool
+	swr          float64
+	fault        int
+	silent       bool
+	temperature  float64
+	updated      time.Time
+}
+
+// NewKPA500 creates a KPA500 emulator in standby on 40m
+func NewKPA500() *KPA500 {
+	return &KPA500{
+		Gain:           16,
+		MaxPower:       600,
+		IdleVolts:      72.0,
+		VoltsSag:       0.015,
+		Efficiency:     0.55,
+		Ambient:        30,
+		MaxTemperature: 85,
+		band:           "03",
+		swr:            1.0,
+		temperature:    30,
+		updated:        time.Now(),
+	}
+}
+
+// Serve answers commands from the controller on t until t is closed
+func (k *KPA500) Serve(t transport.Transport) error {
+	return serve(t, k.getTrace, k.handle)
+}
+
+// SetTrace sets a function to be called with every command received
+func (k *KPA500) SetTrace(trace TraceFunc) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.trace = trace
+}
+
+func (k *KPA500) getTrace() TraceFunc {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.trace
+}
+
+// ListenPipe registers the emulator as the in-memory pipe name
+func (k *KPA500) ListenPipe(name string) {
+	transport.RegisterPipe(name, func(t transport.Transport) {
+		_ = k.Serve(t)
+	})
+}
+
+// SetDrive sets the RF drive (in watts) coming from the radio while it transmits
+func (k *KPA500) SetDrive(watts float64) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.update()
+	k.drive = watts
+	k.checkLimits()
+}
+
+// SetTransmitting keys or unkeys the amplifier
+func (k *KPA500) SetTransmitting(tx bool) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.update()
+	k.transmitting = tx
+	k.checkLimits()
+}
+
+// SetSWR sets the SWR of the load presented to the amplifier
+func (k *KPA500) SetSWR(swr float64) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.swr = swr
+}
+
+// InjectFault makes the KPA500 report fault and drop to standby, like the real amplifier
+func (k *KPA500) InjectFault(fault int) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.update()
+	k.trip(fault)
+}
+
+// ScheduleFault injects fault after d has passed
+func (k *KPA500) ScheduleFault(d time.Duration, fault int) {
+	time.AfterFunc(d, func() {
+		k.InjectFault(fault)
+	})
+}
+
+// ClearFault clears any active fault, same as the ^FLC command
+func (k *KPA500) ClearFault() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.fault = KPA500FaultNone
+}
+
+// SetSilent stops the KPA500 from responding to any command, like it was powered off or unplugged
+func (k *KPA500) SetSilent(silent bool) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.silent = silent
+}
+
+// Mode returns 0 for standby, 1 for operate
+func (k *KPA500) Mode() int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.mode
+}
+
+// Band returns the band the KPA500 is set to, in meters
+func (k *KPA500) Band() int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	for b, n := range kpa500Bands {
+		if n == k.band {
+			return b
+		}
+	}
+
+	return 0
+}
+
+// Fault returns the active fault, zero for none
+func (k *KPA500) Fault() int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.fault
+}
+
+// Power returns the current output power in watts
+func (k *KPA500) Power() float64 {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.power()
+}
+
+// Temperature returns the current heatsink temperature
+func (k *KPA500) Temperature() float64 {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.update()
+	return k.temperature
+}
+
+var (
+	// from the KPA500 documentation
+	kpa500Bands = map[int]string{
+		160: "00",
+		80:  "01",
+		60:  "02",
+		40:  "03",
+		30:  "04",
+		20:  "05",
+		17:  "06",
+		15:  "07",
+		12:  "08",
+		10:  "09",
+		6:   "10",
+	}
+)
+
+// power is the output power the PA puts out, drive times Gain up to MaxPower while transmitting in operate
+// it's 0 in standby (the drive bypasses the PA) and while faulted
+func (k *KPA500) power() float64 {
+	if !k.transmitting || k.mode != 1 || k.fault != KPA500FaultNone {
+		return 0
+	}
+
+	p := k.drive * k.Gain
+	if p > k.MaxPower {
+		p = k.MaxPower
+	}
+
+	return p
+}
+
+// voltsAmps returns the PA supply voltage and current draw
+func (k *KPA500) voltsAmps() (float64, float64) {
+	p := k.power()
+	v := k.IdleVolts - p*k.VoltsSag
+	if p == 0 {
+		return v, 0
+	}
+
+	return v, p / (v * k.Efficiency)
+}
+
+// update moves the heatsink temperature forward to now
+func (k *KPA500) update() {
+	now := time.Now()
+	dt := now.Sub(k.updated).Seconds()
+	k.updated = now
+
+	// heat from what the PA dissipates, cooled towards ambient by the fan
+	v, a := k.voltsAmps()
+	dissipated := v*a - k.power()
+	k.temperature += dissipated*dt*0.02 - (k.temperature-k.Ambient)*dt*0.05
+	if k.temperature < k.Ambient {
+		k.temperature = k.Ambient
+	}
+
+	if k.temperature > k.MaxTemperature {
+		k.trip(KPA500FaultHighTemperature)
+	}
+}
+
+// checkLimits trips a fault when the amplifier is pushed past what it can do
+func (k *KPA500) checkLimits() {
+	if !k.transmitting || k.mode != 1 {
+		return
+	}
+
+	if k.drive*k.Gain > k.MaxPower {
+		k.trip(KPA500FaultHighCurrent)
+	} else if k.swr > 3.0 {
+		k.trip(KPA500FaultHighReflected)
+	}
+}
+
+// trip sets fault and drops to standby
+func (k *KPA500) trip(fault int) {
+	k.fault = fault
+	if fault != KPA500FaultNone {
+		k.mode = 0
+	}
+}
+
+// handle answers a single command
+func (k *KPA500) handle(c *conn, cmd string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.silent {
+		return
+	}
+
+	k.update()
+
+	switch {
+	case cmd == "^OS":
+		c.reply(fmt.Sprintf("^OS%d;", k.mode))
+
+	case strings.HasPrefix(cmd, "^OS"):
+		m, err := strconv.Atoi(strings.TrimPrefix(cmd, "^OS"))
+		if err != nil || m < 0 || m > 1 {
+			c.reply("?;")
+			return
+		}
+		// can't go to operate while faulted
+		if m == 1 && k.fault != KPA500FaultNone {
+			return
+		}
+		k.mode = m
+		k.checkLimits()
+
+	case cmd == "^BN":
+		c.reply(fmt.Sprintf("^BN%s;", k.band))
+
+	case strings.HasPrefix(cmd, "^BN"):
+		b := strings.TrimPrefix(cmd, "^BN")
+		for _, n := range kpa500Bands {
+			if n == b {
+				k.band = b
+				return
+			}
+		}
+		c.reply("?;")
+
+	case cmd == "^WS":
+		c.reply(fmt.Sprintf("^WS%03d %03d;", int(k.power()+0.5), int(k.swr*10+0.5)))
+
+	case cmd == "^FL":
+		c.reply(fmt.Sprintf("^FL%02d;", k.fault))
+
+	case cmd == "^FLC":
+		k.fault = KPA500FaultNone
+
+	case cmd == "^VI":
+		v, a := k.voltsAmps()
+		c.reply(fmt.Sprintf("^VI%03d %03d;", int(v*10+0.5), int(a*10+0.5)))
+
+	case cmd == "^TM":
+		c.reply(fmt.Sprintf("^TM%03d;", int(k.temperature+0.5)))
+
+	default:
+		c.reply("?;")
+	}
+}
@@ -0,0 +1,21 @@
+package device
+
+import "fmt"
+
+// errors returned by all device drivers, so callers can tell why communication with a device failed
+var (
+	// ErrTimeout is returned when the device did not respond in time
+	ErrTimeout = fmt.Errorf("no response from device")
+
+	// ErrPortClosed is returned when the connection to the device was closed, by Close or Reopen, during the request
+	ErrPortClosed = fmt.Errorf("port closed")
+
+	// ErrMalformedResponse is returned, wrapped with the response, when the device response could not be understood
+	ErrMalformedResponse = fmt.Errorf("malformed response from device")
+
+	// ErrDeviceRejected is returned when the device responded that it would not carry out the request
+	ErrDeviceRejected = fmt.Errorf("device rejected request")
+
+	// ErrNotSupported is returned when the device model doesn't support the request
+	ErrNotSupported = fmt.Errorf("not supported by device")
+)
@@ -0,0 +1,197 @@
+package icom
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bbathe/icom-powercombo-controller/device"
+	"github.com/bbathe/icom-powercombo-controller/device/icom/civ"
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+	"github.com/bbathe/icom-powercombo-controller/util"
+)
+
+// pendingRequest is a command waiting for the radio to answer, collided is signalled if a collision is seen on the bus instead
+type pendingRequest struct {
+	match    func(civ.Frame) bool
+	reply    chan civ.Frame
+	collided chan struct{}
+}
+
+// bus is one open connection to the CI-V bus, a single reader goroutine routes replies to the waiting request
+// and hands everything else the radio sends to dispatch
+type bus struct {
+	p       transport.Transport
+	address byte
+	closed  util.AtomFlag
+
+	dispatch func(civ.Frame)
+
+	// sniff records everything read & written, nil if not sniffing
+	sniff *Sniffer
+
+	mutexPending sync.Mutex
+	pending      *pendingRequest
+
+	// closed when the reader exits, err is why
+	done chan struct{}
+	err  error
+}
+
+// newBus starts reading frames from p, frames from the radio at address that don't answer a request are passed to dispatch
+// sniff can be nil, otherwise every frame read or written is recorded
+func newBus(p transport.Transport, address byte, dispatch func(civ.Frame), sniff *Sniffer) *bus {
+	b := &bus{
+		p:        p,
+		address:  address,
+		dispatch: dispatch,
+		sniff:    sniff,
+		done:     make(chan struct{}),
+	}
+
+	go b.read()
+
+	return b
+}
+
+// close closes the connection and waits for the reader to finish
+func (b *bus) close() {
+	b.closed.Set(true)
+	_ = b.p.Close()
+
+	<-b.done
+}
+
+// read reads frames until the connection is closed or fails
+func (b *bus) read() {
+	defer close(b.done)
+
+	var msg []byte
+	buf := make([]byte, 64)
+
+	for {
+		n, err := b.p.Read(buf)
+		if b.closed.IsTrue() {
+			b.err = device.ErrPortClosed
+			return
+		}
+		if err != nil {
+			log.Printf("%+v", err)
+			b.err = err
+			return
+		}
+
+		for _, c := range buf[:n] {
+			msg = append(msg, c)
+			if c != civ.Terminator {
+				continue
+			}
+			b.sniff.Record(false, msg)
+
+			f, err := civ.Parse(msg)
+			switch {
+			case err == civ.ErrCollision:
+				// our command may have been what collided, let it be sent again
+				log.Printf("%+v: % X", err, msg)
+				b.collision()
+			case err != nil:
+				// garbled, whatever it was is lost
+				log.Printf("%+v: % X", err, msg)
+			default:
+				b.deliver(f)
+			}
+			msg = nil
+		}
+	}
+}
+
+// deliver routes f to the request waiting for it, or to dispatch if there isn't one
+func (b *bus) deliver(f civ.Frame) {
+	// only interested in what the radio sends, not other controllers or our own echo
+	if f.From != b.address {
+		return
+	}
+
+	b.mutexPending.Lock()
+	pr := b.pending
+	if pr != nil && pr.match(f) {
+		b.pending = nil
+		b.mutexPending.Unlock()
+
+		pr.reply <- f
+		return
+	}
+	b.mutexPending.Unlock()
+
+	b.dispatch(f)
+}
+
+// collision tells the request waiting for an answer, if there is one, that a collision was seen
+func (b *bus) collision() {
+	b.mutexPending.Lock()
+	pr := b.pending
+	b.pending = nil
+	b.mutexPending.Unlock()
+
+	if pr != nil {
+		pr.collided <- struct{}{}
+	}
+}
+
+// request sends f and waits up to timeout for a frame from the radio that match accepts,
+// civ.ErrCollision is returned if a collision was seen on the bus while waiting
+func (b *bus) request(f civ.Frame, match func(civ.Frame) bool, timeout time.Duration) (civ.Frame, error) {
+	pr := &pendingRequest{
+		match:    match,
+		reply:    make(chan civ.Frame, 1),
+		collided: make(chan struct{}, 1),
+	}
+
+	b.mutexPending.Lock()
+	b.pending = pr
+	b.mutexPending.Unlock()
+
+	defer func() {
+		b.mutexPending.Lock()
+		if b.pending == pr {
+			b.pending = nil
+		}
+		b.mutexPending.Unlock()
+	}()
+
+	err := b.write(f)
+	if err != nil {
+		return civ.Frame{}, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-pr.reply:
+		return reply, nil
+	case <-pr.collided:
+		return civ.Frame{}, civ.ErrCollision
+	case <-b.done:
+		return civ.Frame{}, b.err
+	case <-timer.C:
+		return civ.Frame{}, device.ErrTimeout
+	}
+}
+
+// write sends f on the bus
+func (b *bus) write(f civ.Frame) error {
+	msg := f.Bytes()
+	b.sniff.Record(true, msg)
+
+	_, err := b.p.Write(msg)
+	if b.closed.IsTrue() {
+		return device.ErrPortClosed
+	}
+	if err != nil {
+		log.Printf("%+v", err)
+		return err
+	}
+
+	return nil
+}
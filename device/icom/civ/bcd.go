@@ -0,0 +1,99 @@
+package civ
+
+import "fmt"
+
+// EncodeBCD converts n to size big endian BCD bytes, two digits per byte
+func EncodeBCD(n int, size int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrBCDOutOfRange, n)
+	}
+
+	b := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		b[i] = byte((n%100/10)<<4 | n%10)
+		n /= 100
+	}
+	if n > 0 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrBCDOutOfRange, size)
+	}
+
+	return b, nil
+}
+
+// DecodeBCD converts big endian BCD bytes to a number
+func DecodeBCD(b []byte) (int, error) {
+	n := 0
+	for _, v := range b {
+		hi, lo := int(v>>4), int(v&0x0F)
+		if hi > 9 || lo > 9 {
+			return 0, fmt.Errorf("%w: % X", ErrNotBCD, b)
+		}
+		n = n*100 + hi*10 + lo
+	}
+
+	return n, nil
+}
+
+// EncodeFrequency converts freq (in Hz) to size BCD bytes, least significant first
+// radios up to HF/50MHz use 5 bytes, VHF/UHF & microwave radios use 6
+func EncodeFrequency(freq int64, size int) ([]byte, error) {
+	if freq < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrBCDOutOfRange, freq)
+	}
+
+	b := make([]byte, size)
+	for i := range b {
+		d := freq % 100
+		b[i] = byte((d/10)<<4 | d%10)
+		freq /= 100
+	}
+	if freq > 0 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrBCDOutOfRange, size)
+	}
+
+	return b, nil
+}
+
+// DecodeFrequency converts 5 or 6 BCD bytes, least significant first, to a frequency in Hz
+func DecodeFrequency(b []byte) (int64, error) {
+	if len(b) != 5 && len(b) != 6 {
+		return 0, fmt.Errorf("%w: frequency is %d bytes", ErrNotBCD, len(b))
+	}
+
+	var freq int64
+	for i := len(b) - 1; i >= 0; i-- {
+		n, err := DecodeBCD(b[i : i+1])
+		if err != nil {
+			return 0, err
+		}
+		freq = freq*100 + int64(n)
+	}
+
+	return freq, nil
+}
+
+// EncodeLevel converts a level setting (0-255) to the 2 BCD bytes the radio expects
+func EncodeLevel(level int) ([]byte, error) {
+	if level > 255 {
+		return nil, fmt.Errorf("%w: level %d", ErrBCDOutOfRange, level)
+	}
+
+	return EncodeBCD(level, 2)
+}
+
+// DecodeLevel converts the 2 BCD bytes of a level or meter reading (0-255) to a number
+func DecodeLevel(b []byte) (int, error) {
+	if len(b) != 2 {
+		return 0, fmt.Errorf("%w: level is %d bytes", ErrNotBCD, len(b))
+	}
+
+	level, err := DecodeBCD(b)
+	if err != nil {
+		return 0, err
+	}
+	if level > 255 {
+		return 0, fmt.Errorf("%w: level %d", ErrBCDOutOfRange, level)
+	}
+
+	return level, nil
+}
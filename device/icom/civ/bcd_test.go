@@ -0,0 +1,185 @@
+package civ
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFrequency(t *testing.T) {
+	tests := []struct {
+		name string
+		freq int64
+		raw  []byte
+	}{
+		{
+			name: "hf in 5 bytes",
+			freq: 14074000,
+			raw:  []byte{0x00, 0x40, 0x07, 0x14, 0x00},
+		},
+		{
+			name: "6m in 5 bytes",
+			freq: 50313000,
+			raw:  []byte{0x00, 0x30, 0x31, 0x50, 0x00},
+		},
+		{
+			name: "uhf in 6 bytes",
+			freq: 1296100000,
+			raw:  []byte{0x00, 0x00, 0x10, 0x96, 0x12, 0x00},
+		},
+		{
+			name: "microwave in 6 bytes",
+			freq: 10368100000,
+			raw:  []byte{0x00, 0x00, 0x10, 0x68, 0x03, 0x01},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := EncodeFrequency(tt.freq, len(tt.raw))
+			if err != nil {
+				t.Fatalf("EncodeFrequency(%d, %d) returned %v", tt.freq, len(tt.raw), err)
+			}
+			if !bytes.Equal(b, tt.raw) {
+				t.Errorf("EncodeFrequency(%d, %d) = % X, want % X", tt.freq, len(tt.raw), b, tt.raw)
+			}
+
+			freq, err := DecodeFrequency(tt.raw)
+			if err != nil {
+				t.Fatalf("DecodeFrequency(% X) returned %v", tt.raw, err)
+			}
+			if freq != tt.freq {
+				t.Errorf("DecodeFrequency(% X) = %d, want %d", tt.raw, freq, tt.freq)
+			}
+		})
+	}
+}
+
+func TestFrequencyErrors(t *testing.T) {
+	_, err := EncodeFrequency(10368100000, 5)
+	if !errors.Is(err, ErrBCDOutOfRange) {
+		t.Errorf("EncodeFrequency(10368100000, 5) returned %v, want %v", err, ErrBCDOutOfRange)
+	}
+
+	_, err = EncodeFrequency(-1, 5)
+	if !errors.Is(err, ErrBCDOutOfRange) {
+		t.Errorf("EncodeFrequency(-1, 5) returned %v, want %v", err, ErrBCDOutOfRange)
+	}
+
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{
+			name: "4 bytes",
+			raw:  []byte{0x00, 0x40, 0x07, 0x14},
+		},
+		{
+			name: "7 bytes",
+			raw:  []byte{0x00, 0x00, 0x10, 0x68, 0x03, 0x01, 0x00},
+		},
+		{
+			name: "not bcd",
+			raw:  []byte{0x00, 0x4A, 0x07, 0x14, 0x00},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeFrequency(tt.raw)
+			if !errors.Is(err, ErrNotBCD) {
+				t.Errorf("DecodeFrequency(% X) returned %v, want %v", tt.raw, err, ErrNotBCD)
+			}
+		})
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		level int
+		raw   []byte
+	}{
+		{
+			name:  "minimum",
+			level: 0,
+			raw:   []byte{0x00, 0x00},
+		},
+		{
+			name:  "middle",
+			level: 128,
+			raw:   []byte{0x01, 0x28},
+		},
+		{
+			name:  "maximum",
+			level: 255,
+			raw:   []byte{0x02, 0x55},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := EncodeLevel(tt.level)
+			if err != nil {
+				t.Fatalf("EncodeLevel(%d) returned %v", tt.level, err)
+			}
+			if !bytes.Equal(b, tt.raw) {
+				t.Errorf("EncodeLevel(%d) = % X, want % X", tt.level, b, tt.raw)
+			}
+
+			level, err := DecodeLevel(tt.raw)
+			if err != nil {
+				t.Fatalf("DecodeLevel(% X) returned %v", tt.raw, err)
+			}
+			if level != tt.level {
+				t.Errorf("DecodeLevel(% X) = %d, want %d", tt.raw, level, tt.level)
+			}
+		})
+	}
+}
+
+func TestLevelErrors(t *testing.T) {
+	encode := []int{-1, 256, 9999}
+	for _, level := range encode {
+		_, err := EncodeLevel(level)
+		if !errors.Is(err, ErrBCDOutOfRange) {
+			t.Errorf("EncodeLevel(%d) returned %v, want %v", level, err, ErrBCDOutOfRange)
+		}
+	}
+
+	tests := []struct {
+		name string
+		raw  []byte
+		err  error
+	}{
+		{
+			name: "over 255",
+			raw:  []byte{0x02, 0x56},
+			err:  ErrBCDOutOfRange,
+		},
+		{
+			name: "not bcd",
+			raw:  []byte{0x00, 0xFF},
+			err:  ErrNotBCD,
+		},
+		{
+			name: "1 byte",
+			raw:  []byte{0x55},
+			err:  ErrNotBCD,
+		},
+		{
+			name: "3 bytes",
+			raw:  []byte{0x00, 0x01, 0x28},
+			err:  ErrNotBCD,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeLevel(tt.raw)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("DecodeLevel(% X) returned %v, want %v", tt.raw, err, tt.err)
+			}
+		})
+	}
+}
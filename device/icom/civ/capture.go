@@ -0,0 +1,70 @@
+package civ
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// layout of the timestamp in capture lines, fixed width so they line up
+const CaptureTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// Capture is the bytes of one frame seen on the bus, as recorded by a sniffer
+type Capture struct {
+	Time time.Time
+
+	// Sent is true if the frame was written by us, false if it was read from the bus
+	Sent bool
+	Raw  []byte
+}
+
+// String returns c as a line of a capture log:
+// timestamp, < for read or > for sent, the raw bytes and after a ; the addresses & what the frame means
+func (c Capture) String() string {
+	dir := "<"
+	if c.Sent {
+		dir = ">"
+	}
+
+	return fmt.Sprintf("%s %s % X ; %s", c.Time.Format(CaptureTimeLayout), dir, c.Raw, c.Describe())
+}
+
+// Describe returns who sent the frame to who and what it means, e.g. E0>94 read frequency
+func (c Capture) Describe() string {
+	f, err := Parse(c.Raw)
+	if err != nil {
+		return fmt.Sprintf("??>?? %v", err)
+	}
+
+	return fmt.Sprintf("%02X>%02X %s", f.From, f.To, Describe(f))
+}
+
+// ParseCapture reads a line of a capture log back, anything after the raw bytes is ignored
+func ParseCapture(line string) (Capture, error) {
+	fields := strings.Fields(strings.SplitN(line, ";", 2)[0])
+	if len(fields) < 3 {
+		return Capture{}, fmt.Errorf("not a capture line: %q", line)
+	}
+
+	t, err := time.Parse(CaptureTimeLayout, fields[0])
+	if err != nil {
+		return Capture{}, err
+	}
+
+	var sent bool
+	switch fields[1] {
+	case "<":
+	case ">":
+		sent = true
+	default:
+		return Capture{}, fmt.Errorf("unknown direction %q", fields[1])
+	}
+
+	raw, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil {
+		return Capture{}, err
+	}
+
+	return Capture{Time: t, Sent: sent, Raw: raw}, nil
+}
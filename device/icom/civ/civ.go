@@ -0,0 +1,225 @@
+package civ
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CI-V framing bytes
+const (
+	Preamble   = 0xFE
+	Terminator = 0xFD
+
+	// reply codes, sent in the command position
+	OK = 0xFB
+	NG = 0xFA
+
+	// jammer code sent when the radio detects a collision on the bus
+	Collision = 0xFC
+)
+
+// well known addresses
+const (
+	// ControllerAddress is the address we use on the bus
+	ControllerAddress = 0xE0
+
+	// BroadcastAddress is where transceive frames are sent
+	BroadcastAddress = 0x00
+)
+
+// commands
+const (
+	CmdTransceiveFrequency = 0x00
+	CmdTransceiveMode      = 0x01
+	CmdReadFrequency       = 0x03
+	CmdReadMode            = 0x04
+	CmdSetFrequency        = 0x05
+	CmdSetMode             = 0x06
+	CmdVFO                 = 0x07
+	CmdSplit               = 0x0F
+	CmdLevel               = 0x14
+	CmdMeter               = 0x15
+	CmdSettings            = 0x1A
+	CmdVarious             = 0x1C
+	CmdVFOFrequency        = 0x25
+)
+
+// first data byte of CmdVFO
+const (
+	VFOMainSubBand = 0xD2
+)
+
+// first data byte of CmdVFOFrequency
+const (
+	VFOSelected   = 0x00
+	VFOUnselected = 0x01
+)
+
+// data byte of CmdVarious SubVariousATU, the radio's internal antenna tuner
+const (
+	ATUOff  = 0x00
+	ATUOn   = 0x01
+	ATUTune = 0x02
+)
+
+// subcommands
+const (
+	SubLevelRFPower = 0x0A
+	SubMeterPo      = 0x11
+	SubMeterSWR     = 0x12
+	SubMeterALC     = 0x13
+	SubMeterId      = 0x16
+	SubSettingsData = 0x06
+	SubVariousTX    = 0x00
+	SubVariousATU   = 0x01
+)
+
+var (
+	ErrShortFrame    = errors.New("ci-v frame too short")
+	ErrNoPreamble    = errors.New("ci-v frame missing preamble")
+	ErrNoTerminator  = errors.New("ci-v frame missing terminator")
+	ErrCollision     = errors.New("ci-v bus collision")
+	ErrNotBCD        = errors.New("not a bcd number")
+	ErrBCDOutOfRange = errors.New("number does not fit in bcd bytes")
+)
+
+// commands whose first data byte is a subcommand
+var hasSubcommand = map[byte]bool{
+	0x13: true,
+	0x14: true,
+	0x15: true,
+	0x16: true,
+	0x18: true,
+	0x19: true,
+	0x1A: true,
+	0x1B: true,
+	0x1C: true,
+	0x1E: true,
+	0x21: true,
+	0x27: true,
+}
+
+// Frame is one CI-V message: FE FE to from cmd [sub] data FD
+type Frame struct {
+	To      byte
+	From    byte
+	Command byte
+
+	// Subcommand is only sent for commands that take one, see HasSubcommand
+	Subcommand byte
+	Data       []byte
+}
+
+// NewFrame creates a frame from the controller to the radio at address
+func NewFrame(address byte, cmd byte, data ...byte) Frame {
+	f := Frame{
+		To:      address,
+		From:    ControllerAddress,
+		Command: cmd,
+	}
+
+	if HasSubcommand(cmd) && len(data) > 0 {
+		f.Subcommand = data[0]
+		data = data[1:]
+	}
+	f.Data = append([]byte{}, data...)
+
+	return f
+}
+
+// HasSubcommand returns true if cmd is followed by a subcommand
+func HasSubcommand(cmd byte) bool {
+	return hasSubcommand[cmd]
+}
+
+// Bytes returns the frame as sent on the bus
+func (f Frame) Bytes() []byte {
+	b := []byte{Preamble, Preamble, f.To, f.From, f.Command}
+	if HasSubcommand(f.Command) {
+		b = append(b, f.Subcommand)
+	}
+	b = append(b, f.Data...)
+
+	return append(b, Terminator)
+}
+
+// String returns the frame as hex bytes
+func (f Frame) String() string {
+	return fmt.Sprintf("% X", f.Bytes())
+}
+
+// IsOK returns true if the frame is an OK reply
+func (f Frame) IsOK() bool {
+	return f.Command == OK && len(f.Data) == 0
+}
+
+// IsNG returns true if the frame is an NG (no good) reply
+func (f Frame) IsNG() bool {
+	return f.Command == NG && len(f.Data) == 0
+}
+
+// IsReplyTo returns true if f is the radio at address answering the controller
+func (f Frame) IsReplyTo(address byte) bool {
+	return f.To == ControllerAddress && f.From == address
+}
+
+// IsTransceive returns true if f was broadcast by a radio to report a change made on it
+func (f Frame) IsTransceive() bool {
+	return f.To == BroadcastAddress && (f.Command == CmdTransceiveFrequency || f.Command == CmdTransceiveMode)
+}
+
+// Parse decodes one complete frame, b must start with the preamble and end with the terminator
+func Parse(b []byte) (Frame, error) {
+	if IsCollision(b) {
+		return Frame{}, ErrCollision
+	}
+
+	// FE FE to from cmd FD
+	if len(b) < 6 {
+		return Frame{}, ErrShortFrame
+	}
+	if b[0] != Preamble || b[1] != Preamble {
+		return Frame{}, ErrNoPreamble
+	}
+	if b[len(b)-1] != Terminator {
+		return Frame{}, ErrNoTerminator
+	}
+
+	f := Frame{
+		To:      b[2],
+		From:    b[3],
+		Command: b[4],
+	}
+
+	data := b[5 : len(b)-1]
+	if HasSubcommand(f.Command) {
+		if len(data) == 0 {
+			return Frame{}, ErrShortFrame
+		}
+		f.Subcommand = data[0]
+		data = data[1:]
+	}
+	f.Data = append([]byte{}, data...)
+
+	return f, nil
+}
+
+// IsCollision returns true if b holds the jammer code, the frame it was part of was lost
+func IsCollision(b []byte) bool {
+	// jammer code replaces the addresses or command, it's never valid there
+	if len(b) > 5 {
+		b = b[:5]
+	}
+	for _, v := range b {
+		if v == Collision {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CollisionFrame returns the jammer code as sent by a radio that saw a collision
+func CollisionFrame() []byte {
+	return []byte{Collision, Collision, Collision, Terminator}
+}
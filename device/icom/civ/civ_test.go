@@ -0,0 +1,194 @@
+package civ
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   []byte
+		frame Frame
+	}{
+		{
+			name:  "read frequency",
+			raw:   []byte{0xFE, 0xFE, 0x94, 0xE0, 0x03, 0xFD},
+			frame: Frame{To: 0x94, From: 0xE0, Command: CmdReadFrequency, Data: []byte{}},
+		},
+		{
+			name:  "frequency reply",
+			raw:   []byte{0xFE, 0xFE, 0xE0, 0x94, 0x03, 0x00, 0x40, 0x07, 0x14, 0x00, 0xFD},
+			frame: Frame{To: 0xE0, From: 0x94, Command: CmdReadFrequency, Data: []byte{0x00, 0x40, 0x07, 0x14, 0x00}},
+		},
+		{
+			name:  "read rf power",
+			raw:   []byte{0xFE, 0xFE, 0x94, 0xE0, 0x14, 0x0A, 0xFD},
+			frame: Frame{To: 0x94, From: 0xE0, Command: CmdLevel, Subcommand: SubLevelRFPower, Data: []byte{}},
+		},
+		{
+			name:  "set rf power",
+			raw:   []byte{0xFE, 0xFE, 0x94, 0xE0, 0x14, 0x0A, 0x01, 0x28, 0xFD},
+			frame: Frame{To: 0x94, From: 0xE0, Command: CmdLevel, Subcommand: SubLevelRFPower, Data: []byte{0x01, 0x28}},
+		},
+		{
+			name:  "ok",
+			raw:   []byte{0xFE, 0xFE, 0xE0, 0x94, 0xFB, 0xFD},
+			frame: Frame{To: 0xE0, From: 0x94, Command: OK, Data: []byte{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse(% X) returned %v", tt.raw, err)
+			}
+			if f.To != tt.frame.To || f.From != tt.frame.From || f.Command != tt.frame.Command ||
+				f.Subcommand != tt.frame.Subcommand || !bytes.Equal(f.Data, tt.frame.Data) {
+				t.Errorf("Parse(% X) = %+v, want %+v", tt.raw, f, tt.frame)
+			}
+
+			b := f.Bytes()
+			if !bytes.Equal(b, tt.raw) {
+				t.Errorf("Bytes() = % X, want % X", b, tt.raw)
+			}
+		})
+	}
+}
+
+func TestNewFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  byte
+		data []byte
+		raw  []byte
+	}{
+		{
+			name: "without subcommand",
+			cmd:  CmdReadFrequency,
+			raw:  []byte{0xFE, 0xFE, 0x94, 0xE0, 0x03, 0xFD},
+		},
+		{
+			name: "with subcommand",
+			cmd:  CmdVarious,
+			data: []byte{SubVariousTX},
+			raw:  []byte{0xFE, 0xFE, 0x94, 0xE0, 0x1C, 0x00, 0xFD},
+		},
+		{
+			name: "with subcommand & data",
+			cmd:  CmdLevel,
+			data: []byte{SubLevelRFPower, 0x02, 0x55},
+			raw:  []byte{0xFE, 0xFE, 0x94, 0xE0, 0x14, 0x0A, 0x02, 0x55, 0xFD},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewFrame(0x94, tt.cmd, tt.data...).Bytes()
+			if !bytes.Equal(b, tt.raw) {
+				t.Errorf("NewFrame(0x94, %02X, % X).Bytes() = % X, want % X", tt.cmd, tt.data, b, tt.raw)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		err  error
+	}{
+		{
+			name: "collision",
+			raw:  CollisionFrame(),
+			err:  ErrCollision,
+		},
+		{
+			name: "collision in the addresses",
+			raw:  []byte{0xFE, 0xFE, 0xFC, 0xFC, 0x03, 0xFD},
+			err:  ErrCollision,
+		},
+		{
+			name: "short",
+			raw:  []byte{0xFE, 0xFE, 0x94, 0xE0, 0xFD},
+			err:  ErrShortFrame,
+		},
+		{
+			name: "empty",
+			raw:  []byte{},
+			err:  ErrShortFrame,
+		},
+		{
+			name: "missing subcommand",
+			raw:  []byte{0xFE, 0xFE, 0x94, 0xE0, 0x14, 0xFD},
+			err:  ErrShortFrame,
+		},
+		{
+			name: "no preamble",
+			raw:  []byte{0x00, 0xFE, 0x94, 0xE0, 0x03, 0xFD},
+			err:  ErrNoPreamble,
+		},
+		{
+			name: "no terminator",
+			raw:  []byte{0xFE, 0xFE, 0x94, 0xE0, 0x03, 0x00},
+			err:  ErrNoTerminator,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.raw)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse(% X) returned %v, want %v", tt.raw, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReplies(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		ok   bool
+		ng   bool
+	}{
+		{
+			name: "ok",
+			raw:  []byte{0xFE, 0xFE, 0xE0, 0x94, 0xFB, 0xFD},
+			ok:   true,
+		},
+		{
+			name: "ng",
+			raw:  []byte{0xFE, 0xFE, 0xE0, 0x94, 0xFA, 0xFD},
+			ng:   true,
+		},
+		{
+			name: "ok with data",
+			raw:  []byte{0xFE, 0xFE, 0xE0, 0x94, 0xFB, 0x00, 0xFD},
+		},
+		{
+			name: "frequency reply",
+			raw:  []byte{0xFE, 0xFE, 0xE0, 0x94, 0x03, 0x00, 0x40, 0x07, 0x14, 0x00, 0xFD},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse(% X) returned %v", tt.raw, err)
+			}
+			if f.IsOK() != tt.ok {
+				t.Errorf("IsOK() = %t, want %t", f.IsOK(), tt.ok)
+			}
+			if f.IsNG() != tt.ng {
+				t.Errorf("IsNG() = %t, want %t", f.IsNG(), tt.ng)
+			}
+			if !f.IsReplyTo(0x94) {
+				t.Errorf("IsReplyTo(0x94) = false, want true")
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package civ
+
+import (
+	"fmt"
+	"strings"
+)
+
+// names of the meters read with CmdMeter
+var meterNames = map[byte]string{
+	SubMeterPo:  "Po",
+	SubMeterSWR: "SWR",
+	SubMeterALC: "ALC",
+	SubMeterId:  "Id",
+}
+
+// Describe returns what f is asking for or reporting in words, e.g. "set frequency 14.074000 MHz"
+// a command with no data is a read, with data it's either a set or the radio's answer, the addresses tell which
+func Describe(f Frame) string {
+	read := len(f.Data) == 0
+
+	switch f.Command {
+	case OK:
+		return "OK"
+
+	case NG:
+		return "NG"
+
+	case CmdTransceiveFrequency:
+		return "transceive frequency " + describeFrequency(f.Data)
+
+	case CmdTransceiveMode:
+		return "transceive mode " + describeMode(f.Data)
+
+	case CmdReadFrequency:
+		if read {
+			return "read frequency"
+		}
+		return "frequency " + describeFrequency(f.Data)
+
+	case CmdReadMode:
+		if read {
+			return "read mode"
+		}
+		return "mode " + describeMode(f.Data)
+
+	case CmdSetFrequency:
+		return "set frequency " + describeFrequency(f.Data)
+
+	case CmdSetMode:
+		return "set mode " + describeMode(f.Data)
+
+	case CmdVFO:
+		if len(f.Data) > 0 && f.Data[0] == VFOMainSubBand {
+			if len(f.Data) == 1 {
+				return "read main/sub band"
+			}
+			if f.Data[1] == 0x01 {
+				return "main/sub band sub"
+			}
+			return "main/sub band main"
+		}
+
+	case CmdSplit:
+		if read {
+			return "read split"
+		}
+		return "split " + describeOnOff(f.Data[0])
+
+	case CmdLevel:
+		if f.Subcommand == SubLevelRFPower {
+			if read {
+				return "read rf power"
+			}
+			return "rf power " + describeLevel(f.Data)
+		}
+
+	case CmdMeter:
+		if name, ok := meterNames[f.Subcommand]; ok {
+			if read {
+				return "read meter " + name
+			}
+			return fmt.Sprintf("meter %s %s", name, describeLevel(f.Data))
+		}
+
+	case CmdSettings:
+		if f.Subcommand == SubSettingsData {
+			if read {
+				return "read data mode"
+			}
+			// some radios have D1-D3, anything but 00 is on
+			s := "data mode on"
+			if f.Data[0] == 0x00 {
+				s = "data mode off"
+			}
+			if len(f.Data) > 1 && f.Data[1] != 0x00 {
+				s += fmt.Sprintf(" FIL%d", f.Data[1])
+			}
+			return s
+		}
+
+	case CmdVarious:
+		if f.Subcommand == SubVariousTX {
+			if read {
+				return "read tx"
+			}
+			return "tx " + describeOnOff(f.Data[0])
+		}
+		if f.Subcommand == SubVariousATU {
+			if read {
+				return "read tuner"
+			}
+			if f.Data[0] == ATUTune {
+				return "tuner tune"
+			}
+			return "tuner " + describeOnOff(f.Data[0])
+		}
+
+	case CmdVFOFrequency:
+		if len(f.Data) > 0 && (f.Data[0] == VFOSelected || f.Data[0] == VFOUnselected) {
+			vfo := "selected"
+			if f.Data[0] == VFOUnselected {
+				vfo = "unselected"
+			}
+			if len(f.Data) == 1 {
+				return fmt.Sprintf("read %s vfo frequency", vfo)
+			}
+			return fmt.Sprintf("%s vfo frequency %s", vfo, describeFrequency(f.Data[1:]))
+		}
+	}
+
+	// something we don't use, show it raw
+	s := fmt.Sprintf("command %02X", f.Command)
+	if HasSubcommand(f.Command) {
+		s += fmt.Sprintf(" %02X", f.Subcommand)
+	}
+	if !read {
+		s += fmt.Sprintf(" % X", f.Data)
+	}
+
+	return s
+}
+
+// describeFrequency returns the BCD frequency in b as MHz
+func describeFrequency(b []byte) string {
+	freq, err := DecodeFrequency(b)
+	if err != nil {
+		return fmt.Sprintf("% X (%v)", b, err)
+	}
+
+	return fmt.Sprintf("%d.%06d MHz", freq/1000000, freq%1000000)
+}
+
+// describeMode returns the mode & filter in b, e.g. USB FIL1
+func describeMode(b []byte) string {
+	if len(b) == 0 {
+		return "?"
+	}
+
+	s := []string{ModeName(b[0])}
+	if len(b) > 1 {
+		s = append(s, fmt.Sprintf("FIL%d", b[1]))
+	}
+
+	return strings.Join(s, " ")
+}
+
+// describeLevel returns the BCD level (0-255) in b
+func describeLevel(b []byte) string {
+	level, err := DecodeLevel(b)
+	if err != nil {
+		return fmt.Sprintf("% X (%v)", b, err)
+	}
+
+	return fmt.Sprint(level)
+}
+
+// describeOnOff returns on for 01, off for anything else
+func describeOnOff(b byte) string {
+	if b == 0x01 {
+		return "on"
+	}
+
+	return "off"
+}
@@ -0,0 +1,50 @@
+package civ
+
+import "fmt"
+
+// operating modes, as sent in mode frames
+const (
+	ModeLSB   = 0x00
+	ModeUSB   = 0x01
+	ModeAM    = 0x02
+	ModeCW    = 0x03
+	ModeRTTY  = 0x04
+	ModeFM    = 0x05
+	ModeWFM   = 0x06
+	ModeCWR   = 0x07
+	ModeRTTYR = 0x08
+	ModeDV    = 0x17
+)
+
+var modeNames = map[byte]string{
+	ModeLSB:   "LSB",
+	ModeUSB:   "USB",
+	ModeAM:    "AM",
+	ModeCW:    "CW",
+	ModeRTTY:  "RTTY",
+	ModeFM:    "FM",
+	ModeWFM:   "WFM",
+	ModeCWR:   "CW-R",
+	ModeRTTYR: "RTTY-R",
+	ModeDV:    "DV",
+}
+
+// ModeName returns the name of mode, e.g. USB, or its hex code if it isn't known
+func ModeName(mode byte) string {
+	if name, ok := modeNames[mode]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("%02X", mode)
+}
+
+// ModeCode returns the code for the mode called name, false if there isn't one
+func ModeCode(name string) (byte, bool) {
+	for code, n := range modeNames {
+		if n == name {
+			return code, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,38 @@
+package icom
+
+import (
+	"fmt"
+
+	"github.com/bbathe/icom-powercombo-controller/device/icom/civ"
+)
+
+// CommandError is returned when the radio didn't carry out a command, Err is why:
+// device.ErrDeviceRejected if it answered NG, device.ErrTimeout if it didn't answer, civ.ErrCollision if the frame was lost on the bus
+type CommandError struct {
+	// Command is the frame that was sent
+	Command civ.Frame
+
+	// Reply is the last answer from the radio, nil if there wasn't one
+	Reply *civ.Frame
+
+	// Attempts is how many times the command was sent
+	Attempts int
+
+	Err error
+}
+
+func (e *CommandError) Error() string {
+	s := fmt.Sprintf("ci-v command %s: %v", e.Command, e.Err)
+	if e.Reply != nil {
+		s += fmt.Sprintf(", reply %s", e.Reply)
+	}
+	if e.Attempts > 1 {
+		s += fmt.Sprintf(", after %d attempts", e.Attempts)
+	}
+
+	return s
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,357 @@
+// Package lan connects to Icom radios over the network with the UDP remote control protocol used by RS-BA1,
+// e.g. the IC-705, IC-9700 & IC-7610, carrying CI-V without a cable
+package lan
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+)
+
+// Kind is the transport kind to select in config, the port is user:password@host[:port]
+const Kind = "icomlan"
+
+var (
+	// control port the radio listens on unless another is given
+	DefaultPort = 50001
+
+	// how often the login token is renewed, the radio drops the session if it isn't
+	tokenRenewInterval = 60 * time.Second
+
+	// name the session is shown with on the radio
+	clientName = "powercombo"
+)
+
+func init() {
+	transport.Register(Kind, func(address string, baud int) (transport.Transport, error) {
+		return Open(address)
+	})
+}
+
+// session is a login to the radio with its CI-V stream open
+type session struct {
+	host     string
+	username string
+	password string
+
+	control *stream
+	civ     *stream
+
+	// innerSeq numbers the requests on the control stream, civSeq the CI-V data packets
+	mutexSeq   sync.Mutex
+	innerSeq   uint16
+	civSeq     uint16
+	tokRequest uint16
+	token      uint32
+
+	// device is our end of the pipe handed out as the transport
+	device transport.Transport
+
+	closeOnce sync.Once
+}
+
+// Open logs in to the radio at address, user:password@host[:port], and opens its CI-V stream
+// the returned transport carries CI-V frames like a serial port would
+func Open(address string) (transport.Transport, error) {
+	s, err := parseAddress(address)
+	if err != nil {
+		log.Printf("%+v", err)
+		return nil, err
+	}
+
+	err = s.login()
+	if err != nil {
+		log.Printf("%+v", err)
+		s.close()
+		return nil, err
+	}
+
+	err = s.openCIV()
+	if err != nil {
+		log.Printf("%+v", err)
+		s.close()
+		return nil, err
+	}
+
+	host, device := transport.NewPipe()
+	s.device = device
+
+	go s.fromRadio()
+	go s.toRadio()
+	go s.maintain()
+
+	return host, nil
+}
+
+// parseAddress reads user:password@host[:port] into a session that isn't connected yet
+// errors only ever show the host, the address holds the password
+func parseAddress(address string) (*session, error) {
+	u, err := url.Parse("//" + address)
+	if err != nil {
+		// the url error repeats the whole address
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return nil, fmt.Errorf("invalid icom lan address: %w", err)
+	}
+	if u.User == nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid icom lan address %q, expected user:password@host[:port]", u.Host)
+	}
+
+	// the radio only takes what passcode can obfuscate
+	password, _ := u.User.Password()
+	if !isPrintableASCII(u.User.Username()) || !isPrintableASCII(password) {
+		return nil, fmt.Errorf("invalid icom lan address %q, the username & password must be printable ASCII", u.Host)
+	}
+	port := u.Port()
+	if port == "" {
+		port = fmt.Sprint(DefaultPort)
+	}
+
+	return &session{
+		host:       net.JoinHostPort(u.Hostname(), port),
+		username:   u.User.Username(),
+		password:   password,
+		tokRequest: uint16(rand.Intn(0xffff)),
+	}, nil
+}
+
+// isPrintableASCII returns true if s is only printable ASCII characters, space to ~
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// request returns the request fields for the next request of kind from us
+func (s *session) request(kind byte) request {
+	s.mutexSeq.Lock()
+	defer s.mutexSeq.Unlock()
+
+	s.innerSeq++
+
+	return request{
+		reply:      fromClient,
+		kind:       kind,
+		innerSeq:   s.innerSeq,
+		tokRequest: s.tokRequest,
+		token:      s.token,
+	}
+}
+
+// login connects the control stream, logs in and confirms the token
+func (s *session) login() error {
+	var err error
+
+	s.control, err = newStream()
+	if err != nil {
+		return err
+	}
+
+	err = s.control.connect(s.host)
+	if err != nil {
+		return fmt.Errorf("icom lan: connecting to %s: %w", s.host, err)
+	}
+
+	err = s.control.send(loginPacket(header{}, s.request(requestLogin), s.username, s.password, clientName))
+	if err != nil {
+		return err
+	}
+
+	b, err := s.control.next(connectTimeout, func(b []byte) bool {
+		return len(b) == sizeLoginResponse
+	})
+	if err != nil {
+		return fmt.Errorf("icom lan: login: %w", err)
+	}
+	if binary.LittleEndian.Uint32(b[0x30:]) == errorLoginFailed {
+		return fmt.Errorf("icom lan: login to %s failed, check the username & password", s.host)
+	}
+
+	s.mutexSeq.Lock()
+	s.token = parseRequest(b).token
+	s.mutexSeq.Unlock()
+
+	return s.control.send(tokenPacket(header{}, s.request(requestTokenConfirm)))
+}
+
+// openCIV asks the radio for its CI-V stream and connects to it
+func (s *session) openCIV() error {
+	var err error
+
+	s.civ, err = newStream()
+	if err != nil {
+		return err
+	}
+
+	// the radio says who it is, that's sent back with the request for the stream
+	b, err := s.control.next(connectTimeout, func(b []byte) bool {
+		return len(b) == sizeConnInfo
+	})
+	if err != nil {
+		return fmt.Errorf("icom lan: waiting for radio information: %w", err)
+	}
+
+	err = s.control.send(connInfoPacket(header{}, s.request(requestConnInfo), b[0x20:0x60], s.username, s.civ.localPort()))
+	if err != nil {
+		return err
+	}
+
+	b, err = s.control.next(connectTimeout, func(b []byte) bool {
+		return len(b) == sizeStatus
+	})
+	if err != nil {
+		return fmt.Errorf("icom lan: waiting for ci-v port: %w", err)
+	}
+
+	port := int(binary.BigEndian.Uint16(b[0x42:]))
+	if binary.LittleEndian.Uint32(b[0x30:]) != 0 || port == 0 {
+		return fmt.Errorf("icom lan: radio refused the ci-v stream, it may be in use by another client")
+	}
+
+	host, _, err := net.SplitHostPort(s.host)
+	if err != nil {
+		return err
+	}
+
+	err = s.civ.connect(net.JoinHostPort(host, fmt.Sprint(port)))
+	if err != nil {
+		return fmt.Errorf("icom lan: connecting to ci-v port %d: %w", port, err)
+	}
+
+	return s.civ.send(openClosePacket(header{}, s.nextCIVSeq(), civOpen))
+}
+
+// nextCIVSeq returns the sequence number for the next CI-V stream packet
+func (s *session) nextCIVSeq() uint16 {
+	s.mutexSeq.Lock()
+	defer s.mutexSeq.Unlock()
+
+	s.civSeq++
+	return s.civSeq
+}
+
+// fromRadio passes the CI-V bytes from the radio to the transport
+func (s *session) fromRadio() {
+	for {
+		select {
+		case b := <-s.civ.packets:
+			data, ok := parseCIV(b)
+			if !ok {
+				continue
+			}
+
+			_, err := s.device.Write(data)
+			if err != nil {
+				s.close()
+				return
+			}
+
+		case <-s.civ.done:
+			if s.civ.err != errStreamClosed {
+				log.Printf("%+v", s.civ.err)
+			}
+			s.close()
+			return
+		}
+	}
+}
+
+// toRadio sends what is written to the transport to the radio, until the transport is closed
+func (s *session) toRadio() {
+	buf := make([]byte, 256)
+
+	for {
+		n, err := s.device.Read(buf)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("%+v", err)
+			}
+			s.close()
+			return
+		}
+		if n == 0 {
+			continue
+		}
+
+		err = s.civ.send(civPacket(header{}, s.nextCIVSeq(), buf[:n]))
+		if err != nil {
+			log.Printf("%+v", err)
+			s.close()
+			return
+		}
+	}
+}
+
+// maintain renews the token and watches the control stream for the radio dropping the session
+func (s *session) maintain() {
+	ticker := time.NewTicker(tokenRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := s.control.send(tokenPacket(header{}, s.request(requestTokenRenew)))
+			if err != nil {
+				log.Printf("%+v", err)
+				s.close()
+				return
+			}
+
+		case b := <-s.control.packets:
+			// radio ending the session
+			if len(b) == sizeStatus && b[0x40] == 0x01 {
+				log.Printf("%+v", errDisconnected)
+				s.close()
+				return
+			}
+
+		case <-s.control.done:
+			if s.control.err != errStreamClosed {
+				log.Printf("%+v", s.control.err)
+			}
+			s.close()
+			return
+
+		case <-s.civ.done:
+			return
+		}
+	}
+}
+
+// close closes the CI-V stream, gives up the token and disconnects, the transport reads EOF after
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		if s.civ != nil {
+			if s.civ.closed.IsFalse() && s.civ.remote != nil {
+				_ = s.civ.send(openClosePacket(header{}, s.nextCIVSeq(), civClose))
+			}
+			s.civ.close()
+		}
+
+		if s.control != nil {
+			if s.control.closed.IsFalse() && s.control.remote != nil {
+				_ = s.control.send(tokenPacket(header{}, s.request(requestTokenRemove)))
+			}
+			s.control.close()
+		}
+
+		if s.device != nil {
+			_ = s.device.Close()
+		}
+	})
+}
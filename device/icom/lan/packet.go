@@ -0,0 +1,290 @@
+package lan
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// packet types, in the header of every packet
+const (
+	typeData        = 0x00
+	typeRetransmit  = 0x01
+	typeAreYouThere = 0x03
+	typeIAmHere     = 0x04
+	typeDisconnect  = 0x05
+	typeAreYouReady = 0x06
+	typePing        = 0x07
+)
+
+// packet sizes, most packets are told apart by their size
+const (
+	sizeControl         = 0x10
+	sizePing            = 0x15
+	sizeCIVHeader       = 0x15
+	sizeOpenClose       = 0x16
+	sizeRetransmitRange = 0x18
+	sizeToken           = 0x40
+	sizeStatus          = 0x50
+	sizeLoginResponse   = 0x60
+	sizeLogin           = 0x80
+	sizeConnInfo        = 0x90
+)
+
+// requests carried in login, token & conninfo packets
+const (
+	requestLogin        = 0x00
+	requestTokenRemove  = 0x01
+	requestTokenConfirm = 0x02
+	requestConnInfo     = 0x03
+	requestTokenRenew   = 0x05
+
+	// requestreply is 0x01 from the client & 0x02 from the radio
+	fromClient = 0x01
+	fromRadio  = 0x02
+)
+
+const (
+	// first byte of a CI-V data packet's payload header
+	civMarker = 0xc1
+
+	// openclose packet magic, to open or close the CI-V stream
+	civOpen  = 0x04
+	civClose = 0x00
+
+	// error field of a login response when the username or password is wrong
+	errorLoginFailed = 0xfeffffff
+)
+
+// header is the start of every packet
+type header struct {
+	length uint32
+	kind   uint16
+	seq    uint16
+	sentID uint32
+	rcvdID uint32
+}
+
+// put writes h to the start of b, with the length of b
+func (h header) put(b []byte) {
+	binary.LittleEndian.PutUint32(b[0x00:], uint32(len(b)))
+	binary.LittleEndian.PutUint16(b[0x04:], h.kind)
+	binary.LittleEndian.PutUint16(b[0x06:], h.seq)
+	binary.LittleEndian.PutUint32(b[0x08:], h.sentID)
+	binary.LittleEndian.PutUint32(b[0x0c:], h.rcvdID)
+}
+
+// parseHeader reads the header of b, false if b is too short or the length doesn't match
+func parseHeader(b []byte) (header, bool) {
+	if len(b) < sizeControl {
+		return header{}, false
+	}
+
+	h := header{
+		length: binary.LittleEndian.Uint32(b[0x00:]),
+		kind:   binary.LittleEndian.Uint16(b[0x04:]),
+		seq:    binary.LittleEndian.Uint16(b[0x06:]),
+		sentID: binary.LittleEndian.Uint32(b[0x08:]),
+		rcvdID: binary.LittleEndian.Uint32(b[0x0c:]),
+	}
+
+	return h, int(h.length) == len(b)
+}
+
+// controlPacket builds a packet that is only a header, e.g. are you there
+func controlPacket(kind uint16, seq uint16, sentID uint32, rcvdID uint32) []byte {
+	b := make([]byte, sizeControl)
+	header{kind: kind, seq: seq, sentID: sentID, rcvdID: rcvdID}.put(b)
+
+	return b
+}
+
+// pingPacket builds a ping, or the reply to one
+func pingPacket(seq uint16, sentID uint32, rcvdID uint32, reply bool, t uint32) []byte {
+	b := make([]byte, sizePing)
+	header{kind: typePing, seq: seq, sentID: sentID, rcvdID: rcvdID}.put(b)
+	if reply {
+		b[0x10] = 0x01
+	}
+	binary.LittleEndian.PutUint32(b[0x11:], t)
+
+	return b
+}
+
+// request is the part shared by login, token, conninfo & status packets
+type request struct {
+	reply      byte
+	kind       byte
+	innerSeq   uint16
+	tokRequest uint16
+	token      uint32
+}
+
+// put writes r into b after the header
+func (r request) put(b []byte) {
+	binary.BigEndian.PutUint16(b[0x12:], uint16(len(b)-0x10))
+	b[0x14] = r.reply
+	b[0x15] = r.kind
+	binary.BigEndian.PutUint16(b[0x16:], r.innerSeq)
+	binary.LittleEndian.PutUint16(b[0x1a:], r.tokRequest)
+	binary.LittleEndian.PutUint32(b[0x1c:], r.token)
+}
+
+// parseRequest reads the request part of b, which must be at least sizeToken long
+func parseRequest(b []byte) request {
+	return request{
+		reply:      b[0x14],
+		kind:       b[0x15],
+		innerSeq:   binary.BigEndian.Uint16(b[0x16:]),
+		tokRequest: binary.LittleEndian.Uint16(b[0x1a:]),
+		token:      binary.LittleEndian.Uint32(b[0x1c:]),
+	}
+}
+
+// loginPacket builds the client's login, username & password are obfuscated with passcode
+func loginPacket(h header, r request, username string, password string, name string) []byte {
+	b := make([]byte, sizeLogin)
+	h.put(b)
+	r.put(b)
+	copy(b[0x40:0x50], passcode(username))
+	copy(b[0x50:0x60], passcode(password))
+	copy(b[0x60:0x70], name)
+
+	return b
+}
+
+// loginResponsePacket builds the radio's answer to a login, failed if the username or password was wrong
+func loginResponsePacket(h header, r request, failed bool) []byte {
+	b := make([]byte, sizeLoginResponse)
+	h.put(b)
+	r.put(b)
+	if failed {
+		binary.LittleEndian.PutUint32(b[0x30:], errorLoginFailed)
+	}
+	copy(b[0x40:0x50], "FTTH")
+
+	return b
+}
+
+// tokenPacket builds a token confirm, renew or remove, or the radio's answer to one
+func tokenPacket(h header, r request) []byte {
+	b := make([]byte, sizeToken)
+	h.put(b)
+	r.put(b)
+
+	return b
+}
+
+// connInfoPacket builds a conninfo, from the radio it says who it is, from the client it asks for the CI-V stream on civPort
+// radio is the 0x20-0x60 block from the radio's conninfo (guid/mac & name) which the client sends back
+func connInfoPacket(h header, r request, radio []byte, username string, civPort int) []byte {
+	b := make([]byte, sizeConnInfo)
+	h.put(b)
+	r.put(b)
+	copy(b[0x20:0x60], radio)
+	if username != "" {
+		copy(b[0x60:0x70], passcode(username))
+	}
+
+	// no audio, only CI-V
+	binary.BigEndian.PutUint32(b[0x7c:], uint32(civPort))
+
+	return b
+}
+
+// statusPacket builds the radio's answer to the client's conninfo, with the port the CI-V stream is on
+func statusPacket(h header, r request, civPort int) []byte {
+	b := make([]byte, sizeStatus)
+	h.put(b)
+	r.put(b)
+	binary.BigEndian.PutUint16(b[0x42:], uint16(civPort))
+
+	return b
+}
+
+// openClosePacket builds the request to open or close the CI-V stream
+func openClosePacket(h header, civSeq uint16, magic byte) []byte {
+	b := make([]byte, sizeOpenClose)
+	h.put(b)
+	binary.LittleEndian.PutUint16(b[0x10:], 0x01c0)
+	binary.BigEndian.PutUint16(b[0x13:], civSeq)
+	b[0x15] = magic
+
+	return b
+}
+
+// civPacket builds a packet carrying CI-V bytes
+func civPacket(h header, civSeq uint16, data []byte) []byte {
+	b := make([]byte, sizeCIVHeader+len(data))
+	h.put(b)
+	b[0x10] = civMarker
+	binary.LittleEndian.PutUint16(b[0x11:], uint16(len(data)))
+	binary.BigEndian.PutUint16(b[0x13:], civSeq)
+	copy(b[sizeCIVHeader:], data)
+
+	return b
+}
+
+// parseCIV returns the CI-V bytes in b, false if it isn't a CI-V data packet
+func parseCIV(b []byte) ([]byte, bool) {
+	if len(b) <= sizeCIVHeader || b[0x10] != civMarker {
+		return nil, false
+	}
+
+	n := int(binary.LittleEndian.Uint16(b[0x11:]))
+	if sizeCIVHeader+n != len(b) {
+		return nil, false
+	}
+
+	return b[sizeCIVHeader:], true
+}
+
+// passcodeSequence is the substitution used to obfuscate usernames & passwords, indexed by character + position
+var passcodeSequence = [...]byte{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0x47, 0x5d, 0x4c, 0x42, 0x66, 0x20, 0x23, 0x46, 0x4e, 0x57, 0x45, 0x3d, 0x67, 0x76, 0x60, 0x41,
+	0x62, 0x39, 0x59, 0x2d, 0x68, 0x7e, 0x7c, 0x65, 0x7d, 0x49, 0x29, 0x72, 0x73, 0x78, 0x21, 0x6e,
+	0x5a, 0x5e, 0x4a, 0x3e, 0x71, 0x2c, 0x2a, 0x54, 0x3c, 0x3a, 0x63, 0x4f, 0x43, 0x75, 0x27, 0x79,
+	0x5b, 0x35, 0x70, 0x48, 0x6b, 0x56, 0x6f, 0x34, 0x32, 0x6c, 0x30, 0x61, 0x6d, 0x7b, 0x2f, 0x4b,
+	0x64, 0x38, 0x2b, 0x2e, 0x50, 0x40, 0x3f, 0x55, 0x33, 0x37, 0x25, 0x77, 0x24, 0x26, 0x74, 0x6a,
+	0x28, 0x53, 0x4d, 0x69, 0x22, 0x5c, 0x44, 0x31, 0x36, 0x58, 0x3b, 0x7a, 0x51, 0x5f, 0x52, 0,
+}
+
+// passcode obfuscates s the way the radio expects usernames & passwords, at most 16 characters are used
+// s must be printable ASCII, anything else is past the end of passcodeSequence
+func passcode(s string) []byte {
+	b := make([]byte, 16)
+	for i := 0; i < len(s) && i < len(b); i++ {
+		p := int(s[i]) + i
+		if p > 126 {
+			p = 32 + p%127
+		}
+		b[i] = passcodeSequence[p]
+	}
+
+	return b
+}
+
+// unpasscode reverses passcode, for the stand-in server
+func unpasscode(b []byte) string {
+	var sb strings.Builder
+	for i, c := range b {
+		if c == 0 {
+			break
+		}
+
+		// first printable character that encodes to c in this position
+		for ch := 32; ch < 127; ch++ {
+			p := ch + i
+			if p > 126 {
+				p = 32 + p%127
+			}
+			if passcodeSequence[p] == c {
+				sb.WriteByte(byte(ch))
+				break
+			}
+		}
+	}
+
+	return sb.String()
+}
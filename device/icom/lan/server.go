@@ -0,0 +1,314 @@
+package lan
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+)
+
+// Server stands in for a radio's network remote control, so the lan transport can be used without a radio:
+// it logs clients in, hands out a CI-V stream and passes the device end of a pipe carrying it to accept,
+// the same as a pipe registered with transport.RegisterPipe
+type Server struct {
+	Username string
+	Password string
+
+	// Name is the radio name sent to clients
+	Name string
+
+	accept transport.PipeAcceptFunc
+
+	control *net.UDPConn
+	civ     *net.UDPConn
+
+	mutex  sync.Mutex
+	peers  map[string]*peer
+	nextID uint32
+	logins int
+
+	wg sync.WaitGroup
+}
+
+// peer is one client stream, on the control or CI-V port
+type peer struct {
+	addr     *net.UDPAddr
+	localID  uint32
+	remoteID uint32
+	seq      uint16
+	civSeq   uint16
+
+	// host is our end of the pipe to accept while the CI-V stream is open, toDevice queues what is written to it
+	host     transport.Transport
+	toDevice chan []byte
+}
+
+// NewServer creates a stand-in for a radio that accepts username & password, accept is handed each CI-V stream that is opened
+func NewServer(username string, password string, accept transport.PipeAcceptFunc) *Server {
+	return &Server{
+		Username: username,
+		Password: password,
+		Name:     "IC-705",
+		accept:   accept,
+		peers:    make(map[string]*peer),
+		nextID:   0x10000000,
+	}
+}
+
+// Listen starts serving on address (host:port, port 0 picks one) for the control port, the CI-V port is picked automatically
+// returns the address of the control port
+func (s *Server) Listen(address string) (string, error) {
+	a, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return "", err
+	}
+
+	s.control, err = net.ListenUDP("udp", a)
+	if err != nil {
+		return "", err
+	}
+
+	s.civ, err = net.ListenUDP("udp", &net.UDPAddr{IP: a.IP})
+	if err != nil {
+		s.control.Close()
+		return "", err
+	}
+
+	s.wg.Add(2)
+	go s.serve(s.control, s.handleControl)
+	go s.serve(s.civ, s.handleCIV)
+
+	return s.control.LocalAddr().String(), nil
+}
+
+// Logins returns how many clients have logged in successfully
+func (s *Server) Logins() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.logins
+}
+
+// Close stops serving, open CI-V streams are closed
+func (s *Server) Close() error {
+	if s.control == nil {
+		return nil
+	}
+
+	_ = s.control.Close()
+	_ = s.civ.Close()
+	s.wg.Wait()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, p := range s.peers {
+		p.closeCIV()
+	}
+	s.peers = make(map[string]*peer)
+
+	return nil
+}
+
+// serve reads packets from c and hands the ones from known clients to handle
+func (s *Server) serve(c *net.UDPConn, handle func(c *net.UDPConn, p *peer, b []byte)) {
+	defer s.wg.Done()
+
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := c.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		b := buf[:n]
+		h, ok := parseHeader(b)
+		if !ok {
+			continue
+		}
+
+		s.mutex.Lock()
+		key := c.LocalAddr().String() + ">" + addr.String()
+		p := s.peers[key]
+
+		switch {
+		case h.kind == typeAreYouThere && h.length == sizeControl:
+			// new stream
+			s.nextID++
+			p = &peer{addr: addr, localID: s.nextID, remoteID: h.sentID}
+			s.peers[key] = p
+			s.write(c, p, controlPacket(typeIAmHere, 0, p.localID, p.remoteID))
+			s.mutex.Unlock()
+			continue
+
+		case p == nil:
+			s.mutex.Unlock()
+			continue
+
+		case h.kind == typeAreYouReady && h.length == sizeControl:
+			s.write(c, p, controlPacket(typeAreYouReady, 1, p.localID, p.remoteID))
+
+		case h.kind == typePing && h.length == sizePing:
+			if b[0x10] == 0x00 {
+				s.write(c, p, pingPacket(h.seq, p.localID, p.remoteID, true, binary.LittleEndian.Uint32(b[0x11:])))
+			}
+
+		case h.kind == typeDisconnect:
+			p.closeCIV()
+			delete(s.peers, key)
+
+		case h.kind == typeData && h.length == sizeControl:
+			// idle
+
+		default:
+			handle(c, p, append([]byte{}, b...))
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// write sends b to p, the mutex must be held
+func (s *Server) write(c *net.UDPConn, p *peer, b []byte) {
+	_, err := c.WriteToUDP(b, p.addr)
+	if err != nil {
+		log.Printf("%+v", err)
+	}
+}
+
+// send sends b to p as a tracked packet, the mutex must be held
+func (s *Server) send(c *net.UDPConn, p *peer, b []byte) {
+	p.seq++
+	binary.LittleEndian.PutUint16(b[0x06:], p.seq)
+	binary.LittleEndian.PutUint32(b[0x08:], p.localID)
+	binary.LittleEndian.PutUint32(b[0x0c:], p.remoteID)
+
+	s.write(c, p, b)
+}
+
+// reply returns the request fields answering r
+func reply(r request) request {
+	return request{
+		reply:      fromRadio,
+		kind:       r.kind,
+		innerSeq:   r.innerSeq,
+		tokRequest: r.tokRequest,
+		token:      r.token,
+	}
+}
+
+// handleControl answers logins, token requests & requests for the CI-V stream, the mutex is held
+func (s *Server) handleControl(c *net.UDPConn, p *peer, b []byte) {
+	switch len(b) {
+	case sizeLogin:
+		r := parseRequest(b)
+		failed := unpasscode(b[0x40:0x50]) != s.Username || unpasscode(b[0x50:0x60]) != s.Password
+
+		rr := reply(r)
+		if !failed {
+			rr.token = p.localID ^ 0x5a5a5a5a
+			s.logins++
+		}
+		s.send(c, p, loginResponsePacket(header{}, rr, failed))
+		if failed {
+			return
+		}
+
+		// tell the client who we are
+		info := make([]byte, 0x40)
+		copy(info[0x20:], s.Name)
+		s.send(c, p, connInfoPacket(header{}, reply(request{kind: requestConnInfo, token: rr.token}), info, "", 0))
+
+	case sizeToken:
+		r := parseRequest(b)
+		if r.reply != fromClient {
+			return
+		}
+		s.send(c, p, tokenPacket(header{}, reply(r)))
+
+	case sizeConnInfo:
+		r := parseRequest(b)
+		if r.reply != fromClient {
+			return
+		}
+		s.send(c, p, statusPacket(header{}, reply(r), s.civ.LocalAddr().(*net.UDPAddr).Port))
+	}
+}
+
+// handleCIV opens & closes the CI-V stream and passes CI-V bytes from the client on, the mutex is held
+func (s *Server) handleCIV(c *net.UDPConn, p *peer, b []byte) {
+	if len(b) == sizeOpenClose {
+		switch b[0x15] {
+		case civOpen:
+			if p.host != nil {
+				return
+			}
+
+			host, device := transport.NewPipe()
+			p.host = host
+			p.toDevice = make(chan []byte, 64)
+			go s.accept(device)
+			go s.fromDevice(c, p, host)
+			go toDevice(host, p.toDevice)
+
+		case civClose:
+			p.closeCIV()
+		}
+		return
+	}
+
+	data, ok := parseCIV(b)
+	if !ok || p.host == nil {
+		return
+	}
+
+	// the pipe waits for the device to read it, don't hold everything else up
+	select {
+	case p.toDevice <- append([]byte{}, data...):
+	default:
+		log.Printf("icom lan server: ci-v stream full, dropped % X", data)
+	}
+}
+
+// toDevice writes what the client sends to the device in order, until ch is closed
+func toDevice(host transport.Transport, ch chan []byte) {
+	for b := range ch {
+		_, err := host.Write(b)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// closeCIV closes the CI-V stream if it's open, the server mutex must be held
+func (p *peer) closeCIV() {
+	if p.host == nil {
+		return
+	}
+
+	_ = p.host.Close()
+	close(p.toDevice)
+	p.host = nil
+	p.toDevice = nil
+}
+
+// fromDevice sends what the device writes to the client as CI-V packets, until the stream is closed
+func (s *Server) fromDevice(c *net.UDPConn, p *peer, host transport.Transport) {
+	buf := make([]byte, 256)
+
+	for {
+		n, err := host.Read(buf)
+		if err != nil {
+			return
+		}
+		if n == 0 {
+			continue
+		}
+
+		s.mutex.Lock()
+		p.civSeq++
+		s.send(c, p, civPacket(header{}, p.civSeq, buf[:n]))
+		s.mutex.Unlock()
+	}
+}
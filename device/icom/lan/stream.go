@@ -0,0 +1,343 @@
+package lan
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bbathe/icom-powercombo-controller/device"
+	"github.com/bbathe/icom-powercombo-controller/util"
+)
+
+var (
+	// how long to wait for the radio to answer during the handshake & login
+	connectTimeout = 5 * time.Second
+
+	// how often to repeat handshake packets the radio hasn't answered yet
+	handshakeInterval = 500 * time.Millisecond
+
+	// how often to ping the radio, and send an idle packet when there has been nothing else to send
+	pingInterval = 500 * time.Millisecond
+	idleInterval = 100 * time.Millisecond
+
+	// how long the radio can go without sending anything before the stream is given up on
+	silenceTimeout = 5 * time.Second
+
+	// how many sent packets are kept in case the radio asks for them again
+	retransmitHistory = 64
+
+	errStreamSilent = errors.New("icom lan: radio stopped responding")
+	errDisconnected = errors.New("icom lan: radio disconnected")
+	errStreamClosed = errors.New("icom lan: stream closed")
+)
+
+// stream is one UDP port of a session with the radio, control or CI-V, each has its own ids & sequence numbers
+type stream struct {
+	c      *net.UDPConn
+	remote *net.UDPAddr
+
+	localID  uint32
+	remoteID uint32
+
+	// seq numbers the tracked packets, the radio can ask for any of the recent ones again
+	mutexSend sync.Mutex
+	seq       uint16
+	pingSeq   uint16
+	sent      map[uint16][]byte
+	lastSend  time.Time
+
+	mutexHeard sync.Mutex
+	lastHeard  time.Time
+
+	// packets from the radio the stream doesn't handle itself
+	packets chan []byte
+
+	closed util.AtomFlag
+	quit   chan struct{}
+
+	// closed when the stream stops, err is why
+	done chan struct{}
+	err  error
+}
+
+// newStream creates a stream on a local UDP port, nothing is sent until connect
+func newStream() (*stream, error) {
+	c, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+
+	// the radio tells streams apart by id, the local port makes it unique on this host
+	port := c.LocalAddr().(*net.UDPAddr).Port
+
+	return &stream{
+		c:       c,
+		localID: uint32(time.Now().UnixNano()&0xffff)<<16 | uint32(port),
+		sent:    make(map[uint16][]byte),
+		packets: make(chan []byte, 16),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// localPort returns the UDP port the stream is on
+func (s *stream) localPort() int {
+	return s.c.LocalAddr().(*net.UDPAddr).Port
+}
+
+// connect does the are you there/are you ready handshake with the radio at address, then starts the stream
+func (s *stream) connect(address string) error {
+	var err error
+	s.remote, err = net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+
+	b, err := s.handshake(controlPacket(typeAreYouThere, 0, s.localID, 0), func(h header) bool {
+		return h.kind == typeIAmHere && h.length == sizeControl
+	})
+	if err != nil {
+		return err
+	}
+	h, _ := parseHeader(b)
+	s.remoteID = h.sentID
+
+	_, err = s.handshake(controlPacket(typeAreYouReady, 1, s.localID, s.remoteID), func(h header) bool {
+		return h.kind == typeAreYouReady && h.length == sizeControl
+	})
+	if err != nil {
+		return err
+	}
+
+	s.seq = 1
+	s.heard()
+
+	go s.read()
+	go s.keepalive()
+
+	return nil
+}
+
+// handshake sends b until the radio answers with a packet accept likes
+func (s *stream) handshake(b []byte, accept func(header) bool) ([]byte, error) {
+	deadline := time.Now().Add(connectTimeout)
+	buf := make([]byte, 1500)
+
+	for time.Now().Before(deadline) {
+		_, err := s.c.WriteToUDP(b, s.remote)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.c.SetReadDeadline(time.Now().Add(handshakeInterval))
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			n, _, err := s.c.ReadFromUDP(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return nil, err
+			}
+
+			h, ok := parseHeader(buf[:n])
+			if ok && accept(h) {
+				return append([]byte{}, buf[:n]...), nil
+			}
+		}
+	}
+
+	return nil, device.ErrTimeout
+}
+
+// send sends b, with the header's ids & the next sequence number filled in, and keeps it in case it has to be sent again
+func (s *stream) send(b []byte) error {
+	s.mutexSend.Lock()
+	defer s.mutexSend.Unlock()
+
+	s.seq++
+	binary.LittleEndian.PutUint16(b[0x06:], s.seq)
+	binary.LittleEndian.PutUint32(b[0x08:], s.localID)
+	binary.LittleEndian.PutUint32(b[0x0c:], s.remoteID)
+
+	s.sent[s.seq] = b
+	delete(s.sent, s.seq-uint16(retransmitHistory))
+
+	return s.write(b)
+}
+
+// write sends b as is, the send mutex must be held
+func (s *stream) write(b []byte) error {
+	s.lastSend = time.Now()
+
+	_, err := s.c.WriteToUDP(b, s.remote)
+	if err != nil && s.closed.IsTrue() {
+		return errStreamClosed
+	}
+
+	return err
+}
+
+// resend sends the packet with seq again, if it's still known
+func (s *stream) resend(seq uint16) {
+	s.mutexSend.Lock()
+	defer s.mutexSend.Unlock()
+
+	b, ok := s.sent[seq]
+	if !ok {
+		// too old, send an idle in its place so the radio stops asking
+		b = controlPacket(typeData, seq, s.localID, s.remoteID)
+	}
+
+	_ = s.write(b)
+}
+
+// heard notes that something arrived from the radio
+func (s *stream) heard() {
+	s.mutexHeard.Lock()
+	defer s.mutexHeard.Unlock()
+
+	s.lastHeard = time.Now()
+}
+
+// silentFor returns how long it has been since anything arrived from the radio
+func (s *stream) silentFor() time.Duration {
+	s.mutexHeard.Lock()
+	defer s.mutexHeard.Unlock()
+
+	return time.Since(s.lastHeard)
+}
+
+// read handles the housekeeping packets from the radio and passes the rest on, until the stream stops
+func (s *stream) read() {
+	buf := make([]byte, 1500)
+
+	for {
+		n, _, err := s.c.ReadFromUDP(buf)
+		if err != nil {
+			s.stop(err)
+			return
+		}
+
+		h, ok := parseHeader(buf[:n])
+		if !ok || h.sentID != s.remoteID {
+			continue
+		}
+		s.heard()
+
+		switch {
+		case h.kind == typePing && h.length == sizePing:
+			if buf[0x10] == 0x00 {
+				s.mutexSend.Lock()
+				_ = s.write(pingPacket(h.seq, s.localID, s.remoteID, true, binary.LittleEndian.Uint32(buf[0x11:])))
+				s.mutexSend.Unlock()
+			}
+
+		case h.kind == typeRetransmit && h.length == sizeControl:
+			s.resend(h.seq)
+
+		case h.kind == typeRetransmit && h.length == sizeRetransmitRange:
+			// a range, first & last
+			s.resend(binary.LittleEndian.Uint16(buf[0x10:]))
+			s.resend(binary.LittleEndian.Uint16(buf[0x14:]))
+
+		case h.kind == typeDisconnect:
+			s.stop(errDisconnected)
+			return
+
+		case h.kind == typeData && h.length == sizeControl:
+			// idle
+
+		default:
+			select {
+			case s.packets <- append([]byte{}, buf[:n]...):
+			case <-s.quit:
+				return
+			}
+		}
+	}
+}
+
+// keepalive pings the radio & fills gaps with idle packets, and gives up on the stream if the radio goes quiet
+func (s *stream) keepalive() {
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	idle := time.NewTicker(idleInterval)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ping.C:
+			if s.silentFor() > silenceTimeout {
+				log.Printf("%+v", errStreamSilent)
+				s.stop(errStreamSilent)
+				return
+			}
+
+			s.mutexSend.Lock()
+			s.pingSeq++
+			_ = s.write(pingPacket(s.pingSeq, s.localID, s.remoteID, false, uint32(time.Now().UnixNano()/int64(time.Millisecond))))
+			s.mutexSend.Unlock()
+
+		case <-idle.C:
+			s.mutexSend.Lock()
+			quiet := time.Since(s.lastSend) >= idleInterval
+			s.mutexSend.Unlock()
+
+			if quiet {
+				_ = s.send(controlPacket(typeData, 0, 0, 0))
+			}
+
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// next waits up to timeout for a packet from the radio that accept likes, others are dropped
+func (s *stream) next(timeout time.Duration, accept func([]byte) bool) ([]byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case b := <-s.packets:
+			if accept(b) {
+				return b, nil
+			}
+		case <-s.done:
+			return nil, s.err
+		case <-timer.C:
+			return nil, device.ErrTimeout
+		}
+	}
+}
+
+// stop records why the stream stopped and makes everything waiting on it give up, only the first reason is kept
+func (s *stream) stop(err error) {
+	if !s.closed.CompareAndSet(false, true) {
+		return
+	}
+
+	s.err = err
+	close(s.quit)
+	close(s.done)
+	_ = s.c.Close()
+}
+
+// close tells the radio the stream is going away, then stops it
+func (s *stream) close() {
+	if s.remote != nil && s.closed.IsFalse() {
+		s.mutexSend.Lock()
+		_ = s.write(controlPacket(typeDisconnect, 0, s.localID, s.remoteID))
+		s.mutexSend.Unlock()
+	}
+
+	s.stop(errStreamClosed)
+}
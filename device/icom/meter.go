@@ -0,0 +1,83 @@
+package icom
+
+import (
+	"fmt"
+
+	"github.com/bbathe/icom-powercombo-controller/device/icom/civ"
+)
+
+// meterPoint is a meter reading (0-255) and what it means
+type meterPoint struct {
+	level int
+	value float64
+}
+
+// meter scales from the CI-V reference, readings between points are interpolated
+var meterScales = map[byte][]meterPoint{
+	// percent of full power
+	civ.SubMeterPo: {{0, 0}, {143, 50}, {213, 100}},
+
+	// standing wave ratio
+	civ.SubMeterSWR: {{0, 1.0}, {48, 1.5}, {80, 2.0}, {120, 3.0}},
+
+	// percent of the ALC zone
+	civ.SubMeterALC: {{0, 0}, {120, 100}},
+
+	// PA drain current in amps
+	civ.SubMeterId: {{0, 0}, {97, 10}, {146, 15}, {241, 25}},
+}
+
+// Meters are the radio's meter readings, they only mean something while transmitting
+type Meters struct {
+	// Po is the rf output as a percent of full power
+	Po float64
+
+	SWR float64
+
+	// ALC is how far into the ALC zone the radio is, over 100 is overdriven
+	ALC float64
+
+	// Id is the PA drain current in amps
+	Id float64
+}
+
+// MeterValue converts the reading level (0-255) of meter (e.g. civ.SubMeterSWR) to what it means
+// readings past the end of the scale are extrapolated from its last two points
+func MeterValue(meter byte, level int) (float64, error) {
+	scale, ok := meterScales[meter]
+	if !ok {
+		return 0, fmt.Errorf("unknown meter %02X", meter)
+	}
+
+	i := 1
+	for i < len(scale)-1 && level > scale[i].level {
+		i++
+	}
+	a, b := scale[i-1], scale[i]
+
+	return a.value + float64(level-a.level)*(b.value-a.value)/float64(b.level-a.level), nil
+}
+
+// MeterLevel converts value back to the reading level (0-255) of meter, for emulating the radio
+func MeterLevel(meter byte, value float64) (int, error) {
+	scale, ok := meterScales[meter]
+	if !ok {
+		return 0, fmt.Errorf("unknown meter %02X", meter)
+	}
+
+	i := 1
+	for i < len(scale)-1 && value > scale[i].value {
+		i++
+	}
+	a, b := scale[i-1], scale[i]
+
+	level := a.level + int((value-a.value)*float64(b.level-a.level)/(b.value-a.value)+0.5)
+	if level < 0 {
+		level = 0
+	}
+	if level > 255 {
+		level = 255
+	}
+
+	return level, nil
+}
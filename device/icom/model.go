@@ -0,0 +1,123 @@
+package icom
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Feature is something a radio model may or may not support over CI-V
+type Feature int
+
+const (
+	// FeatureMode is reading the operating mode (0x04) and following it from transceive frames (0x01)
+	FeatureMode Feature = 1 << iota
+
+	// FeatureDataMode is reading the data mode flag (0x1A 0x06)
+	FeatureDataMode
+
+	// FeatureTransmit is reading the transmit state (0x1C 0x00)
+	FeatureTransmit
+
+	// FeatureMeters is reading the Po, SWR, ALC & Id meters (0x15)
+	FeatureMeters
+
+	// FeatureSplit is reading the split state (0x0F) and the unselected VFO frequency (0x25)
+	FeatureSplit
+
+	// FeatureDualBand is reading which of the main & sub bands is selected (0x07 0xD2)
+	FeatureDualBand
+
+	// FeatureATU is switching the internal antenna tuner on & off (0x1C 0x01)
+	FeatureATU
+)
+
+// Model is the profile of an Icom radio model
+type Model struct {
+	Name string
+
+	// Address is the factory default CI-V address
+	Address byte
+
+	// MaxPower is the maximum rf output in watts
+	MaxPower int
+
+	// FrequencyBytes is how many BCD bytes the radio uses for a frequency, 0 takes either 5 or 6
+	FrequencyBytes int
+
+	Features Feature
+}
+
+// PowerCurve returns the rf output for each RF power level used on bands without a calibration, in proportion up to MaxPower
+func (m Model) PowerCurve() PowerCurve {
+	if m.MaxPower <= 0 {
+		return nil
+	}
+
+	return linearPowerCurve(m.MaxPower)
+}
+
+// Has returns true if the model supports f
+func (m Model) Has(f Feature) bool {
+	return m.Features&f == f
+}
+
+var (
+	// models are the radios we know about, by name
+	models = map[string]Model{
+		"IC-7300": {Name: "IC-7300", Address: 0x94, MaxPower: 100, FrequencyBytes: 5, Features: FeatureMode | FeatureDataMode | FeatureTransmit | FeatureMeters | FeatureSplit | FeatureATU},
+		"IC-7610": {Name: "IC-7610", Address: 0x98, MaxPower: 100, FrequencyBytes: 5, Features: FeatureMode | FeatureDataMode | FeatureTransmit | FeatureMeters | FeatureSplit | FeatureDualBand | FeatureATU},
+		"IC-7851": {Name: "IC-7851", Address: 0x8E, MaxPower: 200, FrequencyBytes: 5, Features: FeatureMode | FeatureDataMode | FeatureTransmit | FeatureMeters | FeatureSplit | FeatureDualBand | FeatureATU},
+		"IC-705":  {Name: "IC-705", Address: 0xA4, MaxPower: 10, FrequencyBytes: 5, Features: FeatureMode | FeatureDataMode | FeatureTransmit | FeatureMeters | FeatureSplit},
+		"IC-9700": {Name: "IC-9700", Address: 0xA2, MaxPower: 100, FrequencyBytes: 5, Features: FeatureMode | FeatureDataMode | FeatureTransmit | FeatureMeters | FeatureSplit | FeatureDualBand},
+		"IC-7100": {Name: "IC-7100", Address: 0x88, MaxPower: 100, FrequencyBytes: 5, Features: FeatureMode | FeatureDataMode | FeatureTransmit | FeatureMeters | FeatureSplit},
+	}
+
+	// genericModel is used when no model is configured, everything but dual band is tried, frequencies can be either width
+	// and the address must be configured
+	// the tuner is tried too, it's safer to turn off one that might be there, radios without one reject it
+	genericModel = Model{
+		Name:     "",
+		MaxPower: 100,
+		Features: FeatureMode | FeatureDataMode | FeatureTransmit | FeatureMeters | FeatureSplit | FeatureATU,
+	}
+)
+
+// LookupModel returns the profile for the radio model called name, e.g. IC-7300, the generic profile if name is empty
+func LookupModel(name string) (Model, error) {
+	if name == "" {
+		return genericModel, nil
+	}
+
+	m, ok := models[strings.ToUpper(name)]
+	if !ok {
+		return Model{}, fmt.Errorf("unknown radio model %q", name)
+	}
+
+	return m, nil
+}
+
+// ModelNames returns the names of all the known radio models, sorted
+func ModelNames() []string {
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// DefaultAddress returns the CI-V address to use for the radio model called name when address isn't set, as hex
+func DefaultAddress(name string, address string) string {
+	if address != "" {
+		return address
+	}
+
+	m, err := LookupModel(name)
+	if err != nil || m.Address == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%02X", m.Address)
+}
@@ -0,0 +1,88 @@
+package icom
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// PowerPoint is one calibration measurement, the rf output in watts at an RF power level (0-255)
+type PowerPoint struct {
+	Level int
+	Watts float64
+}
+
+// PowerCurve maps RF power levels to rf output, Icom radios aren't quite linear and differ by band
+// the points are sorted by level and the output never drops as the level goes up
+type PowerCurve []PowerPoint
+
+// linearPowerCurve is rf output in proportion to the RF power level, up to maxPower watts at 255
+// it's what the radio's own 0-100% setting suggests, measure the radio with a wattmeter & configure a calibration for better
+func linearPowerCurve(maxPower int) PowerCurve {
+	return PowerCurve{{Level: 0, Watts: 0}, {Level: 255, Watts: float64(maxPower)}}
+}
+
+// Validate returns an error if c can't be used to set the rf power
+func (c PowerCurve) Validate() error {
+	if len(c) < 2 {
+		return fmt.Errorf("power curve needs at least 2 points, has %d", len(c))
+	}
+
+	for i, p := range c {
+		if p.Level < 0 || p.Level > 255 {
+			return fmt.Errorf("power curve level %d out of range (0-255)", p.Level)
+		}
+		if p.Watts < 0 {
+			return fmt.Errorf("power curve output %.1f W at level %d is negative", p.Watts, p.Level)
+		}
+		if i > 0 && (p.Level <= c[i-1].Level || p.Watts < c[i-1].Watts) {
+			return fmt.Errorf("power curve must go up with the level, level %d is %.1f W after level %d at %.1f W", p.Level, p.Watts, c[i-1].Level, c[i-1].Watts)
+		}
+	}
+
+	return nil
+}
+
+// Max returns the most the radio puts out on the curve, in watts
+func (c PowerCurve) Max() float64 {
+	return c[len(c)-1].Watts
+}
+
+// Level returns the lowest RF power level (0-255) that puts out at least watts, interpolating between the points
+// watts past either end of the curve get the level at that end
+func (c PowerCurve) Level(watts float64) int {
+	if watts <= c[0].Watts {
+		return c[0].Level
+	}
+	if watts >= c.Max() {
+		return c[len(c)-1].Level
+	}
+
+	// first point at or over watts, the one before is under
+	i := sort.Search(len(c), func(i int) bool {
+		return c[i].Watts >= watts
+	})
+	lo, hi := c[i-1], c[i]
+
+	l := float64(lo.Level) + (watts-lo.Watts)*float64(hi.Level-lo.Level)/(hi.Watts-lo.Watts)
+
+	// round up so the radio isn't under driven, but not for float noise on an exact level
+	return int(math.Ceil(l - 1e-9))
+}
+
+// Watts returns what the radio puts out at RF power level (0-255), interpolating between the points
+func (c PowerCurve) Watts(level int) float64 {
+	if level <= c[0].Level {
+		return c[0].Watts
+	}
+	if level >= c[len(c)-1].Level {
+		return c.Max()
+	}
+
+	i := sort.Search(len(c), func(i int) bool {
+		return c[i].Level >= level
+	})
+	lo, hi := c[i-1], c[i]
+
+	return lo.Watts + float64(level-lo.Level)*(hi.Watts-lo.Watts)/float64(hi.Level-lo.Level)
+}
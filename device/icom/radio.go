@@ -1,211 +1,850 @@
 package icom
 
 import (
-	"bytes"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/bbathe/icom-powercombo-controller/device"
+	"github.com/bbathe/icom-powercombo-controller/device/icom/civ"
+	_ "github.com/bbathe/icom-powercombo-controller/device/icom/lan" // network remote control transport
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
 	"github.com/bbathe/icom-powercombo-controller/util"
+)
+
+var (
+	// how long to wait for the radio to answer a command
+	replyTimeout = 500 * time.Millisecond
+
+	// how long GetFrequency waits for a transceive frame
+	frequencyTimeout = transport.DefaultTimeout
+
+	// how many times to try setting rf power before giving up on the radio taking it
+	rfPowerAttempts = 3
 
-	"github.com/albenik/go-serial/v2"
+	// how many times a command is sent again when the radio answers NG or it collides on the bus, unless Retries is set
+	commandRetries = 2
+
+	// how long to wait before sending a command again, gives whatever it collided with time to finish
+	retryDelay = 20 * time.Millisecond
+
+	// how long to wait for the radio to answer each command, unless Timeout is set, commands not listed wait replyTimeout
+	commandTimeouts = map[byte]time.Duration{
+		// polled while transmitting, give up quickly so the bus is free for anything else
+		civ.CmdMeter: 250 * time.Millisecond,
+
+		// radios can be slow to acknowledge level changes while transmitting
+		civ.CmdLevel: time.Second,
+	}
 )
 
+// Radio is a connection to an Icom radio, one connection carries both commands and the transceive frames the radio sends,
+// so a single CI-V port can be used for everything
 type Radio struct {
-	Port    string
-	Baud    int
-	Address string
+	Transport string
+	Port      string
+	Baud      int
+	Model     string
+	Address   string
+
+	// Retries is how many times a command is sent again when the radio answers NG or it collides on the bus,
+	// 0 uses the default & -1 turns retrying off
+	Retries int
 
-	p         *serial.Port
+	// Timeout is how long to wait for the radio to answer any command, 0 uses the defaults for each command
+	Timeout time.Duration
+
+	// Calibration is the radio's measured rf output by band, bands without one are in proportion to the model's maximum
+	Calibration map[int]PowerCurve
+
+	// b is the open connection, nil while closed, model is the profile of Model
 	mutexPort sync.Mutex
-	f         bool
-	closed    util.AtomFlag
+	b         *bus
+	model     Model
+	sniffer   *Sniffer
+
+	// commands are sent one at a time
+	mutexRequest sync.Mutex
+
+	// queried/queriedMode are set once the frequency/mode has been asked for on this connection
+	queried     util.AtomFlag
+	queriedMode util.AtomFlag
+
+	mutexSubscribers sync.Mutex
+	subscribers      map[chan civ.Frame]map[byte]bool
+	frequencies      chan civ.Frame
+	modes            chan civ.Frame
 }
 
-var (
-	errPortClosed = fmt.Errorf("port closed")
-)
+// Mode is the operating mode of the radio
+type Mode struct {
+	// Mode is the name of the mode, e.g. USB or CW
+	Mode string
 
-// OpenRadio creates a connection with the radio
-func OpenRadio(port string, baud int, address string) (*Radio, error) {
-	p, err := serial.Open(port,
-		serial.WithBaudrate(baud),
-		serial.WithReadTimeout(333),
-		serial.WithWriteTimeout(333),
-	)
-	if err != nil {
-		log.Printf("%+v", err)
-		return nil, err
-	}
+	// Filter is which of the filter settings (1-3) is selected
+	Filter int
+
+	// Data is true when the data mode (e.g. USB-D) is on
+	Data bool
+}
 
+// NewRadio creates a radio that is not yet connected, call Reopen to connect
+// kind selects the transport, port is the address of the radio on that transport,
+// model is the radio model (e.g. IC-7300), address is its CI-V address in hex which can be empty to use the model's default
+func NewRadio(kind string, port string, baud int, model string, address string) *Radio {
 	r := new(Radio)
+	r.Transport = kind
 	r.Port = port
 	r.Baud = baud
+	r.Model = model
 	r.Address = address
-	r.p = p
+	r.subscribers = make(map[chan civ.Frame]map[byte]bool)
+	r.frequencies = r.Subscribe(civ.CmdTransceiveFrequency, civ.CmdReadFrequency)
+	r.modes = r.Subscribe(civ.CmdTransceiveMode, civ.CmdReadMode)
+
+	return r
+}
+
+// OpenRadio creates a connection with the radio
+// kind selects the transport, port is the address of the radio on that transport
+func OpenRadio(kind string, port string, baud int, model string, address string) (*Radio, error) {
+	r := NewRadio(kind, port, baud, model, address)
+
+	err := r.Reopen()
+	if err != nil {
+		log.Printf("%+v", err)
+		return nil, err
+	}
 
 	return r, nil
 }
 
+// Reopen closes the connection with the radio, if there is one, and connects again
+func (r *Radio) Reopen() error {
+	r.mutexPort.Lock()
+	defer r.mutexPort.Unlock()
+
+	// make anything waiting on the port give up
+	if r.b != nil {
+		r.b.close()
+		r.b = nil
+	}
+
+	model, err := LookupModel(r.Model)
+	if err != nil {
+		log.Printf("%+v", err)
+		return err
+	}
+
+	a := DefaultAddress(r.Model, r.Address)
+	if a == "" {
+		err = fmt.Errorf("no CI-V address configured for radio")
+		log.Printf("%+v", err)
+		return err
+	}
+
+	address, err := strconv.ParseUint(a, 16, 8)
+	if err != nil {
+		err = fmt.Errorf("invalid radio address %q: %w", a, err)
+		log.Printf("%+v", err)
+		return err
+	}
+
+	p, err := transport.Open(r.Transport, r.Port, r.Baud)
+	if err != nil {
+		log.Printf("%+v", err)
+		return err
+	}
+
+	// forget anything the old connection heard
+	for len(r.frequencies) > 0 {
+		<-r.frequencies
+	}
+	for len(r.modes) > 0 {
+		<-r.modes
+	}
+
+	r.b = newBus(p, byte(address), r.publish, r.sniffer)
+	r.model = model
+	r.queried.Set(false)
+	r.queriedMode.Set(false)
+
+	return nil
+}
+
+// SetSniffer records every frame read or written on the connection with s, nil stops recording
+// it takes effect when the connection is next opened
+func (r *Radio) SetSniffer(s *Sniffer) {
+	r.mutexPort.Lock()
+	defer r.mutexPort.Unlock()
+
+	r.sniffer = s
+}
+
 // Close closes the connection with the radio
 func (r *Radio) Close() error {
-	r.closed.Set(true)
-
 	r.mutexPort.Lock()
 	defer r.mutexPort.Unlock()
 
-	return r.p.Close()
+	if r.b == nil {
+		return nil
+	}
+
+	r.b.close()
+	r.b = nil
+
+	return nil
+}
+
+// Subscribe returns a channel that receives the frames with one of cmds the radio sends that aren't a reply to one of our commands,
+// e.g. transceive frames, all of them if no cmds are given, the oldest frames are dropped when the channel is full
+func (r *Radio) Subscribe(cmds ...byte) chan civ.Frame {
+	r.mutexSubscribers.Lock()
+	defer r.mutexSubscribers.Unlock()
+
+	ch := make(chan civ.Frame, 16)
+	r.subscribers[ch] = make(map[byte]bool)
+	for _, cmd := range cmds {
+		r.subscribers[ch][cmd] = true
+	}
+
+	return ch
 }
 
-// readCIVMessageFromPort reads bytes from port and returns CIV message
-func (r *Radio) readCIVMessageFromPort() ([]byte, error) {
-	var buf bytes.Buffer
-	b := []byte{0}
+// Unsubscribe stops sending frames to ch
+func (r *Radio) Unsubscribe(ch chan civ.Frame) {
+	r.mutexSubscribers.Lock()
+	defer r.mutexSubscribers.Unlock()
 
+	delete(r.subscribers, ch)
+}
+
+// publish hands f to every subscriber interested in it, making room by dropping the oldest frame if a subscriber isn't keeping up
+func (r *Radio) publish(f civ.Frame) {
+	r.mutexSubscribers.Lock()
+	defer r.mutexSubscribers.Unlock()
+
+	for ch, cmds := range r.subscribers {
+		if len(cmds) > 0 && !cmds[f.Command] {
+			continue
+		}
+
+		send(ch, f)
+	}
+}
+
+// send puts f on ch, dropping the oldest frame if ch is full
+func send(ch chan civ.Frame, f civ.Frame) {
 	for {
-		n, err := r.p.Read(b)
-		if r.closed.IsTrue() {
-			return []byte{}, errPortClosed
+		select {
+		case ch <- f:
+			return
+		default:
 		}
-		if err != nil {
-			log.Printf("%+v", err)
-			return []byte{}, err
+
+		select {
+		case <-ch:
+		default:
 		}
+	}
+}
 
-		if n > 0 {
-			// accumulate message bytes
-			buf.Write(b)
+// decodeFrequency converts the BCD frequency the radio sent, it has to be as many bytes as the model uses
+func (r *Radio) decodeFrequency(b []byte) (int64, error) {
+	n := r.Profile().FrequencyBytes
+	if n > 0 && len(b) != n {
+		err := fmt.Errorf("%w: frequency % X, expected %d bytes", device.ErrMalformedResponse, b, n)
+		log.Printf("%+v", err)
+		return 0, err
+	}
 
-			// message terminator?
-			if b[0] == 0xFD {
-				// return CIV message
-				return buf.Bytes(), nil
-			}
-		} else {
-			break
-		}
+	freq, err := civ.DecodeFrequency(b)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", device.ErrMalformedResponse, err)
+		log.Printf("%+v", err)
+		return 0, err
 	}
 
-	// return message
-	return buf.Bytes(), nil
+	return freq, nil
+}
+
+// Profile returns the profile of the radio model, once connected
+func (r *Radio) Profile() Model {
+	r.mutexPort.Lock()
+	defer r.mutexPort.Unlock()
+
+	return r.model
 }
 
-// writeCIVMessageToPort write byte equalivalent of msg to port
-func (r *Radio) writeCIVMessageToPort(msg string) error {
-	// convert from hex string to bytes
-	b, err := hex.DecodeString(msg)
+// PowerCurve returns the rf output for each RF power level on band, the calibration for the band if there is one
+// and the model's otherwise, nil if the model isn't known
+func (r *Radio) PowerCurve(band int) PowerCurve {
+	if c, ok := r.Calibration[band]; ok {
+		return c
+	}
+
+	// from the configured model, the profile isn't loaded until the radio is connected
+	m, err := LookupModel(r.Model)
 	if err != nil {
-		log.Printf("%+v", err)
-		return err
+		return nil
 	}
 
-	// write to port
-	_, err = r.p.Write(b)
-	if r.closed.IsTrue() {
-		return errPortClosed
+	return m.PowerCurve()
+}
+
+// bus returns the open connection
+func (r *Radio) bus() (*bus, error) {
+	r.mutexPort.Lock()
+	defer r.mutexPort.Unlock()
+
+	if r.b == nil {
+		return nil, device.ErrPortClosed
 	}
+
+	return r.b, nil
+}
+
+// request sends the command cmd and waits for the radio's answer that match accepts,
+// the command is sent again if the radio answers NG or it collides with another frame on the bus,
+// the error is a *CommandError unless the port was closed
+func (r *Radio) request(match func(civ.Frame) bool, cmd byte, data ...byte) (civ.Frame, error) {
+	r.mutexRequest.Lock()
+	defer r.mutexRequest.Unlock()
+
+	b, err := r.bus()
 	if err != nil {
-		log.Printf("%+v", err)
-		return err
+		return civ.Frame{}, err
 	}
 
-	return nil
+	ce := &CommandError{
+		Command: civ.NewFrame(b.address, cmd, data...),
+	}
+
+	for ce.Attempts <= r.retries() {
+		if ce.Attempts > 0 {
+			time.Sleep(retryDelay)
+		}
+		ce.Attempts++
+
+		f, err := b.request(ce.Command, func(f civ.Frame) bool {
+			return match(f) || (f.To == civ.ControllerAddress && f.IsNG())
+		}, r.timeout(cmd))
+		switch {
+		case err == device.ErrPortClosed:
+			return civ.Frame{}, err
+
+		case err == civ.ErrCollision:
+			ce.Reply = nil
+			ce.Err = err
+
+		case err != nil:
+			// not worth asking again, a radio that's been switched off won't answer the next one either
+			ce.Reply = nil
+			ce.Err = err
+			return civ.Frame{}, ce
+
+		case f.IsNG() && !match(f):
+			ce.Reply = &f
+			ce.Err = device.ErrDeviceRejected
+
+		default:
+			return f, nil
+		}
+	}
+
+	return civ.Frame{}, ce
+}
+
+// retries returns how many times a command is sent again
+func (r *Radio) retries() int {
+	switch {
+	case r.Retries < 0:
+		return 0
+	case r.Retries == 0:
+		return commandRetries
+	}
+
+	return r.Retries
+}
+
+// timeout returns how long to wait for the radio to answer cmd
+func (r *Radio) timeout(cmd byte) time.Duration {
+	if r.Timeout > 0 {
+		return r.Timeout
+	}
+	if t, ok := commandTimeouts[cmd]; ok {
+		return t
+	}
+
+	return replyTimeout
+}
+
+// isOK returns true if f is an OK reply
+func isOK(f civ.Frame) bool {
+	return f.To == civ.ControllerAddress && f.IsOK()
 }
 
 // GetFrequency returns the current radio frequency
-// it does this by polling for the "Transfer operating frequency data" broadcast message
-// if port is closed during reading, -1 is returned
+// it does this by waiting for the "Transfer operating frequency data" broadcast message,
+// ErrTimeout is returned if no frequency was sent before the wait timed out
 func (r *Radio) GetFrequency() (int64, error) {
-	r.mutexPort.Lock()
-	defer r.mutexPort.Unlock()
+	var (
+		f   civ.Frame
+		err error
+	)
 
-	if !r.f {
+	if r.queried.CompareAndSet(false, true) {
 		// first time after connecting to radio, query for frequency
-		err := r.writeCIVMessageToPort(fmt.Sprintf("FEFE%sE003FD", r.Address))
+		f, err = r.request(func(f civ.Frame) bool {
+			return f.To == civ.ControllerAddress && f.Command == civ.CmdReadFrequency
+		}, civ.CmdReadFrequency)
 		if err != nil {
-			if err == errPortClosed {
-				return -1, nil
+			// ask again next time
+			r.queried.Set(false)
+
+			if !errors.Is(err, device.ErrPortClosed) {
+				log.Printf("%+v", err)
 			}
-			log.Printf("%+v", err)
 			return 0, err
 		}
+	} else {
+		f, err = r.nextFrequency()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return r.decodeFrequency(f.Data)
+}
+
+// nextFrequency waits for a frequency frame from the radio
+func (r *Radio) nextFrequency() (civ.Frame, error) {
+	b, err := r.bus()
+	if err != nil {
+		return civ.Frame{}, err
+	}
+
+	timer := time.NewTimer(frequencyTimeout)
+	defer timer.Stop()
+
+	select {
+	case f := <-r.frequencies:
+		return f, nil
+	case <-b.done:
+		return civ.Frame{}, b.err
+	case <-timer.C:
+		return civ.Frame{}, device.ErrTimeout
+	}
+}
+
+// GetMode returns the current operating mode of the radio
+// it is asked for once after connecting, after that the "Transfer operating mode" broadcast messages are followed,
+// ErrTimeout is returned if the mode hasn't changed since it was last returned
+func (r *Radio) GetMode() (Mode, error) {
+	var (
+		f   civ.Frame
+		err error
+	)
+
+	if !r.Profile().Has(FeatureMode) {
+		return Mode{}, device.ErrNotSupported
+	}
+
+	if r.queriedMode.CompareAndSet(false, true) {
+		// first time after connecting to radio, query for mode
+		f, err = r.request(func(f civ.Frame) bool {
+			return f.To == civ.ControllerAddress && f.Command == civ.CmdReadMode
+		}, civ.CmdReadMode)
+		if err != nil {
+			// ask again next time
+			r.queriedMode.Set(false)
+
+			if !errors.Is(err, device.ErrPortClosed) {
+				log.Printf("%+v", err)
+			}
+			return Mode{}, err
+		}
+	} else {
+		f, err = r.nextMode()
+		if err != nil {
+			return Mode{}, err
+		}
+	}
+
+	// RSP format: mode [filter]
+	if len(f.Data) < 1 {
+		err = fmt.Errorf("%w: mode % X", device.ErrMalformedResponse, f.Data)
+		log.Printf("%+v", err)
+		return Mode{}, err
+	}
+
+	md := Mode{
+		Mode: civ.ModeName(f.Data[0]),
+	}
+	if len(f.Data) > 1 {
+		md.Filter, err = civ.DecodeBCD(f.Data[1:2])
+		if err != nil {
+			err = fmt.Errorf("%w: %v", device.ErrMalformedResponse, err)
+			log.Printf("%+v", err)
+			return Mode{}, err
+		}
+	}
 
-		r.f = true
+	// mode frames don't carry the data mode flag, ask for it
+	md.Data, err = r.getDataMode()
+	if err != nil {
+		if !errors.Is(err, device.ErrPortClosed) {
+			log.Printf("%+v", err)
+		}
+		return Mode{}, err
 	}
 
-	// read ci-v message
-	msg, err := r.readCIVMessageFromPort()
+	return md, nil
+}
+
+// nextMode returns the latest mode frame from the radio without waiting
+func (r *Radio) nextMode() (civ.Frame, error) {
+	_, err := r.bus()
 	if err != nil {
-		if err == errPortClosed {
-			return -1, nil
+		return civ.Frame{}, err
+	}
+
+	var (
+		f  civ.Frame
+		ok bool
+	)
+
+	// only the latest mode matters
+	for {
+		select {
+		case f = <-r.modes:
+			ok = true
+		default:
+			if !ok {
+				return civ.Frame{}, device.ErrTimeout
+			}
+			return f, nil
 		}
+	}
+}
+
+// getDataMode returns true if the radio's data mode is on, radios without data modes reject the request and are always off
+func (r *Radio) getDataMode() (bool, error) {
+	if !r.Profile().Has(FeatureDataMode) {
+		return false, nil
+	}
+
+	f, err := r.request(func(f civ.Frame) bool {
+		return f.To == civ.ControllerAddress && f.Command == civ.CmdSettings && f.Subcommand == civ.SubSettingsData
+	}, civ.CmdSettings, civ.SubSettingsData)
+	if errors.Is(err, device.ErrDeviceRejected) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// RSP format: 1A 06 data [filter]
+	if len(f.Data) < 1 {
+		return false, fmt.Errorf("%w: data mode % X", device.ErrMalformedResponse, f.Data)
+	}
+
+	return f.Data[0] != 0x00, nil
+}
+
+// SetRFPower sets the RF Power of the radio so it puts out watts on band, the level is read back to make sure the radio took it
+// returns the level (0-255) the radio reports, which is still returned if the radio doesn't take the new level, -1 if it isn't known
+func (r *Radio) SetRFPower(band int, watts float64) (int, error) {
+	c := r.PowerCurve(band)
+	if len(c) == 0 {
+		err := fmt.Errorf("no rf power curve for the %dm band, check the radio model %q is known", band, r.Model)
 		log.Printf("%+v", err)
-		return 0, err
+		return -1, err
+	}
+	if watts > c.Max() {
+		log.Printf("radio puts out %.1f W at most on the %dm band, %.1f W asked for", c.Max(), band, watts)
+	}
+	p := c.Level(watts)
+
+	level, err := civ.EncodeLevel(p)
+	if err != nil {
+		log.Printf("%+v", err)
+		return -1, err
 	}
 
-	// is it operating frequency data?
-	if len(msg) == 11 && (msg[2] == 0xE0 || msg[2] == 0x00) {
-		// radio sends as least significant byte first, flip order of bytes
-		fd := fmt.Sprintf("%02X%02X%02X%02X%02X", msg[9], msg[8], msg[7], msg[6], msg[5])
+	actual := -1
+	for attempt := 0; attempt < rfPowerAttempts; attempt++ {
+		// set rf power
+		_, err := r.request(isOK, civ.CmdLevel, append([]byte{civ.SubLevelRFPower}, level...)...)
+		if err != nil {
+			if !errors.Is(err, device.ErrPortClosed) {
+				log.Printf("%+v", err)
+			}
+			return -1, err
+		}
 
-		// convert to number
-		freq, err := strconv.ParseInt(fd, 10, 64)
+		// make sure it took
+		actual, err = r.GetRFPower()
 		if err != nil {
-			return -1, nil
+			if !errors.Is(err, device.ErrPortClosed) {
+				log.Printf("%+v", err)
+			}
+			return -1, err
+		}
+		if actual == p {
+			return actual, nil
 		}
 
-		return freq, nil
+		log.Printf("radio rf power is %d after setting %d, attempt %d", actual, p, attempt+1)
 	}
 
-	return -1, nil
+	err = fmt.Errorf("%w: rf power is %d after setting %d", device.ErrDeviceRejected, actual, p)
+	log.Printf("%+v", err)
+	return actual, err
 }
 
-// SetRFPower sets the RF Power of the radio
-func (r *Radio) SetRFPower(power int) error {
-	r.mutexPort.Lock()
-	defer r.mutexPort.Unlock()
+// GetTransmitting returns true if the radio is transmitting, radios that reject the request are always receiving
+func (r *Radio) GetTransmitting() (bool, error) {
+	if !r.Profile().Has(FeatureTransmit) {
+		return false, device.ErrNotSupported
+	}
+
+	// RSP format: 1C 00 tx
+	f, err := r.request(func(f civ.Frame) bool {
+		return f.To == civ.ControllerAddress && f.Command == civ.CmdVarious && f.Subcommand == civ.SubVariousTX
+	}, civ.CmdVarious, civ.SubVariousTX)
+	if errors.Is(err, device.ErrDeviceRejected) {
+		return false, nil
+	}
+	if err != nil {
+		if !errors.Is(err, device.ErrPortClosed) {
+			log.Printf("%+v", err)
+		}
+		return false, err
+	}
+
+	if len(f.Data) != 1 {
+		err = fmt.Errorf("%w: transmit state % X", device.ErrMalformedResponse, f.Data)
+		log.Printf("%+v", err)
+		return false, err
+	}
+
+	return f.Data[0] != 0x00, nil
+}
+
+// GetSplit returns true if split is on, transmitting on the unselected VFO
+func (r *Radio) GetSplit() (bool, error) {
+	if !r.Profile().Has(FeatureSplit) {
+		return false, device.ErrNotSupported
+	}
+
+	// RSP format: 0F split
+	f, err := r.request(func(f civ.Frame) bool {
+		return f.To == civ.ControllerAddress && f.Command == civ.CmdSplit
+	}, civ.CmdSplit)
+	if err != nil {
+		if !errors.Is(err, device.ErrPortClosed) {
+			log.Printf("%+v", err)
+		}
+		return false, err
+	}
+
+	if len(f.Data) != 1 {
+		err = fmt.Errorf("%w: split % X", device.ErrMalformedResponse, f.Data)
+		log.Printf("%+v", err)
+		return false, err
+	}
+
+	// 00 off, 01 on, 1x are duplex settings
+	return f.Data[0] == 0x01, nil
+}
+
+// GetVFOFrequency returns the frequency of the selected VFO, or the unselected one which is where the radio transmits when split
+func (r *Radio) GetVFOFrequency(selected bool) (int64, error) {
+	if !r.Profile().Has(FeatureSplit) {
+		return 0, device.ErrNotSupported
+	}
+
+	vfo := byte(civ.VFOUnselected)
+	if selected {
+		vfo = civ.VFOSelected
+	}
+
+	// RSP format: 25 vfo frequency
+	f, err := r.request(func(f civ.Frame) bool {
+		return f.To == civ.ControllerAddress && f.Command == civ.CmdVFOFrequency && len(f.Data) > 0 && f.Data[0] == vfo
+	}, civ.CmdVFOFrequency, vfo)
+	if err != nil {
+		if !errors.Is(err, device.ErrPortClosed) {
+			log.Printf("%+v", err)
+		}
+		return 0, err
+	}
+
+	return r.decodeFrequency(f.Data[1:])
+}
+
+// GetSubBand returns true if the sub band is selected on radios with main & sub bands
+func (r *Radio) GetSubBand() (bool, error) {
+	if !r.Profile().Has(FeatureDualBand) {
+		return false, device.ErrNotSupported
+	}
+
+	// RSP format: 07 D2 band
+	f, err := r.request(func(f civ.Frame) bool {
+		return f.To == civ.ControllerAddress && f.Command == civ.CmdVFO && len(f.Data) > 0 && f.Data[0] == civ.VFOMainSubBand
+	}, civ.CmdVFO, civ.VFOMainSubBand)
+	if err != nil {
+		if !errors.Is(err, device.ErrPortClosed) {
+			log.Printf("%+v", err)
+		}
+		return false, err
+	}
+
+	if len(f.Data) != 2 {
+		err = fmt.Errorf("%w: main/sub band % X", device.ErrMalformedResponse, f.Data)
+		log.Printf("%+v", err)
+		return false, err
+	}
 
-	// calculate radio power setting from percentage
-	t := power * 255
-	p := t / 100
-	if t%100 > 0 {
-		p += 1
+	return f.Data[1] == 0x01, nil
+}
+
+// SetATU turns the radio's internal antenna tuner on or off, the state is read back to make sure the radio took it
+// without a model configured, a radio that rejects it is taken to not have a tuner
+func (r *Radio) SetATU(on bool) error {
+	if !r.Profile().Has(FeatureATU) {
+		return device.ErrNotSupported
 	}
 
-	// set rf power
-	err := r.writeCIVMessageToPort(fmt.Sprintf("FEFE%sE0140A%04dFD", r.Address, p))
+	atu := byte(civ.ATUOff)
+	if on {
+		atu = civ.ATUOn
+	}
+
+	_, err := r.request(isOK, civ.CmdVarious, civ.SubVariousATU, atu)
+	if errors.Is(err, device.ErrDeviceRejected) && r.Profile().Name == "" {
+		return device.ErrNotSupported
+	}
 	if err != nil {
-		if err == errPortClosed {
-			return nil
+		if !errors.Is(err, device.ErrPortClosed) {
+			log.Printf("%+v", err)
 		}
+		return err
+	}
+
+	// make sure it took
+	actual, err := r.GetATU()
+	if err != nil {
+		return err
+	}
+	if actual != on {
+		err = fmt.Errorf("%w: tuner is on %t after setting it on %t", device.ErrDeviceRejected, actual, on)
 		log.Printf("%+v", err)
 		return err
 	}
 
-	// read response from radio
-	for {
-		msg, err := r.readCIVMessageFromPort()
-		if err != nil {
-			if err == errPortClosed {
-				return nil
-			}
+	return nil
+}
+
+// GetATU returns true if the radio's internal antenna tuner is on, or tuning
+func (r *Radio) GetATU() (bool, error) {
+	if !r.Profile().Has(FeatureATU) {
+		return false, device.ErrNotSupported
+	}
+
+	// RSP format: 1C 01 atu
+	f, err := r.request(func(f civ.Frame) bool {
+		return f.To == civ.ControllerAddress && f.Command == civ.CmdVarious && f.Subcommand == civ.SubVariousATU
+	}, civ.CmdVarious, civ.SubVariousATU)
+	if err != nil {
+		if !errors.Is(err, device.ErrPortClosed) {
 			log.Printf("%+v", err)
-			return err
 		}
+		return false, err
+	}
+
+	if len(f.Data) != 1 {
+		err = fmt.Errorf("%w: tuner % X", device.ErrMalformedResponse, f.Data)
+		log.Printf("%+v", err)
+		return false, err
+	}
 
-		// response for us from radio?
-		if len(msg) == 6 && msg[2] == 0xE0 {
-			// check status returned from radio
-			if msg[4] != 0xFB {
-				err = fmt.Errorf("error response from radio")
+	return f.Data[0] != civ.ATUOff, nil
+}
+
+// GetMeters reads the Po, SWR, ALC & Id meters from the radio
+func (r *Radio) GetMeters() (Meters, error) {
+	if !r.Profile().Has(FeatureMeters) {
+		return Meters{}, device.ErrNotSupported
+	}
+
+	var (
+		m   Meters
+		err error
+	)
+
+	for _, v := range []struct {
+		meter byte
+		value *float64
+	}{
+		{civ.SubMeterPo, &m.Po},
+		{civ.SubMeterSWR, &m.SWR},
+		{civ.SubMeterALC, &m.ALC},
+		{civ.SubMeterId, &m.Id},
+	} {
+		*v.value, err = r.getMeter(v.meter)
+		if err != nil {
+			if !errors.Is(err, device.ErrPortClosed) {
 				log.Printf("%+v", err)
-				return err
 			}
-			break
+			return Meters{}, err
 		}
 	}
 
-	return nil
+	return m, nil
+}
+
+// getMeter reads meter (e.g. civ.SubMeterPo) from the radio
+func (r *Radio) getMeter(meter byte) (float64, error) {
+	// RSP format: 15 meter level
+	f, err := r.request(func(f civ.Frame) bool {
+		return f.To == civ.ControllerAddress && f.Command == civ.CmdMeter && f.Subcommand == meter
+	}, civ.CmdMeter, meter)
+	if err != nil {
+		return 0, err
+	}
+
+	level, err := civ.DecodeLevel(f.Data)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", device.ErrMalformedResponse, err)
+	}
+
+	return MeterValue(meter, level)
+}
+
+// GetRFPower returns the RF Power level (0-255) of the radio
+func (r *Radio) GetRFPower() (int, error) {
+	// RSP format: 14 0A level
+	f, err := r.request(func(f civ.Frame) bool {
+		return f.To == civ.ControllerAddress && f.Command == civ.CmdLevel && f.Subcommand == civ.SubLevelRFPower
+	}, civ.CmdLevel, civ.SubLevelRFPower)
+	if err != nil {
+		if !errors.Is(err, device.ErrPortClosed) {
+			log.Printf("%+v", err)
+		}
+		return 0, err
+	}
+
+	level, err := civ.DecodeLevel(f.Data)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", device.ErrMalformedResponse, err)
+		log.Printf("%+v", err)
+		return 0, err
+	}
+
+	return level, nil
 }
@@ -0,0 +1,577 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bbathe/icom-powercombo-controller/device/icom"
+	"github.com/bbathe/icom-powercombo-controller/device/icom/civ"
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+)
+
+// TraceFunc is called with a description of every command the radio receives, it must not call back into the Radio
+type TraceFunc func(event string)
+
+// Radio emulates an Icom radio on a CI-V bus, every connection served is another attachment to the same bus
+type Radio struct {
+	mutex       sync.Mutex
+	trace       TraceFunc
+	address     byte
+	freq        int64
+	unselected  int64
+	split       bool
+	subBand     bool
+	mode        byte
+	filter      byte
+	dataMode    bool
+	tx          bool
+	atu         byte
+	noATU       bool
+	rfPower     int
+	curve       icom.PowerCurve
+	swr         float64
+	rejectPower bool
+	ignorePower bool
+	silent      bool
+	collisions  int
+
+	mutexBus    sync.Mutex
+	attachments map[transport.Transport]bool
+}
+
+// NewRadio creates a radio emulator at CI-V address, tuned to 7.074 MHz USB-D FIL1 at full power
+// its rf output is in proportion to the RF power level, up to 100 watts
+func NewRadio(address byte) *Radio {
+	m, _ := icom.LookupModel("")
+
+	return &Radio{
+		address:     address,
+		freq:        7074000,
+		unselected:  7074000,
+		mode:        civ.ModeUSB,
+		filter:      1,
+		dataMode:    true,
+		rfPower:     255,
+		curve:       m.PowerCurve(),
+		swr:         1.0,
+		attachments: make(map[transport.Transport]bool),
+	}
+}
+
+// Serve attaches t to the CI-V bus and processes frames from it until t is closed
+func (r *Radio) Serve(t transport.Transport) error {
+	r.mutexBus.Lock()
+	r.attachments[t] = true
+	r.mutexBus.Unlock()
+
+	defer func() {
+		r.mutexBus.Lock()
+		delete(r.attachments, t)
+		r.mutexBus.Unlock()
+	}()
+
+	var buf bytes.Buffer
+	b := make([]byte, 64)
+
+	for {
+		n, err := t.Read(b)
+		if err != nil {
+			if err == io.EOF || err == transport.ErrClosed {
+				return nil
+			}
+			return err
+		}
+
+		for _, ch := range b[:n] {
+			buf.WriteByte(ch)
+			if ch == civ.Terminator {
+				frame := append([]byte{}, buf.Bytes()...)
+				buf.Reset()
+
+				// everyone else on the bus sees it, like a hub
+				r.broadcast(t, frame)
+				r.handle(frame)
+			}
+		}
+	}
+}
+
+// ListenPipe registers the emulator as the in-memory pipe name, each open of name is another bus attachment
+func (r *Radio) ListenPipe(name string) {
+	transport.RegisterPipe(name, func(t transport.Transport) {
+		_ = r.Serve(t)
+	})
+}
+
+// SetFrequency simulates turning the VFO, the new frequency is sent as a transceive frame
+func (r *Radio) SetFrequency(freq int64) {
+	r.mutex.Lock()
+	r.freq = freq
+	silent := r.silent
+	addr := r.address
+	r.mutex.Unlock()
+
+	if !silent {
+		r.broadcast(nil, civ.Frame{To: civ.BroadcastAddress, From: addr, Command: civ.CmdTransceiveFrequency, Data: encodeFrequency(freq)}.Bytes())
+	}
+}
+
+// SetMode simulates selecting mode (e.g. USB) and data mode on the front panel, the new mode is sent as a transceive frame
+func (r *Radio) SetMode(mode string, dataMode bool) error {
+	code, ok := civ.ModeCode(mode)
+	if !ok {
+		return fmt.Errorf("unknown mode %s", mode)
+	}
+
+	r.mutex.Lock()
+	r.mode = code
+	r.dataMode = dataMode
+	filter := r.filter
+	silent := r.silent
+	addr := r.address
+	r.mutex.Unlock()
+
+	if !silent {
+		r.broadcast(nil, civ.Frame{To: civ.BroadcastAddress, From: addr, Command: civ.CmdTransceiveMode, Data: []byte{code, filter}}.Bytes())
+	}
+
+	return nil
+}
+
+// Mode returns the name of the current mode, with -D appended if data mode is on
+func (r *Radio) Mode() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.dataMode {
+		return civ.ModeName(r.mode) + "-D"
+	}
+
+	return civ.ModeName(r.mode)
+}
+
+// SetSplit simulates turning split on or off, the radio doesn't send anything when it changes
+func (r *Radio) SetSplit(split bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.split = split
+}
+
+// SetUnselectedFrequency simulates tuning the unselected VFO, which is where the radio transmits when split
+func (r *Radio) SetUnselectedFrequency(freq int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.unselected = freq
+}
+
+// SetSubBand simulates selecting the sub (or main) band, the selected & unselected VFOs swap over and the new
+// frequency is sent as a transceive frame
+func (r *Radio) SetSubBand(sub bool) {
+	r.mutex.Lock()
+	if r.subBand != sub {
+		r.freq, r.unselected = r.unselected, r.freq
+	}
+	r.subBand = sub
+	freq := r.freq
+	silent := r.silent
+	addr := r.address
+	r.mutex.Unlock()
+
+	if !silent {
+		r.broadcast(nil, civ.Frame{To: civ.BroadcastAddress, From: addr, Command: civ.CmdTransceiveFrequency, Data: encodeFrequency(freq)}.Bytes())
+	}
+}
+
+// SetTransmitting simulates keying (or unkeying) the radio
+func (r *Radio) SetTransmitting(tx bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.tx = tx
+}
+
+// Frequency returns the current frequency in Hz
+func (r *Radio) Frequency() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.freq
+}
+
+// RFPower returns the current RF power level, 0 - 255
+func (r *Radio) RFPower() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.rfPower
+}
+
+// ATU returns true if the internal antenna tuner is on
+func (r *Radio) ATU() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.atu != civ.ATUOff
+}
+
+// SetATU switches the internal antenna tuner on or off from the front panel
+func (r *Radio) SetATU(on bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.atu = civ.ATUOff
+	if on {
+		r.atu = civ.ATUOn
+	}
+}
+
+// SetNoATU makes the radio one without an internal antenna tuner, it rejects tuner commands
+func (r *Radio) SetNoATU(none bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.noATU = none
+}
+
+// Output returns the rf output in watts at the current RF power level, while transmitting
+func (r *Radio) Output() float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.curve.Watts(r.rfPower)
+}
+
+// SetSWR sets the SWR the radio sees while transmitting
+func (r *Radio) SetSWR(swr float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.swr = swr
+}
+
+// SetRejectRFPower makes the radio answer RF power writes with NG
+func (r *Radio) SetRejectRFPower(reject bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.rejectPower = reject
+}
+
+// SetIgnoreRFPower makes the radio answer RF power writes with OK without changing the level
+func (r *Radio) SetIgnoreRFPower(ignore bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ignorePower = ignore
+}
+
+// SetCollisions makes the radio answer the next n commands addressed to it with the collision jammer code, as if they collided
+func (r *Radio) SetCollisions(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.collisions = n
+}
+
+// SetTrace sets a function to be called with every command received
+func (r *Radio) SetTrace(trace TraceFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.trace = trace
+}
+
+// SetSilent stops the radio from sending anything, like it was switched off
+func (r *Radio) SetSilent(silent bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.silent = silent
+}
+
+// broadcast writes frame to every attachment except from
+func (r *Radio) broadcast(from transport.Transport, frame []byte) {
+	r.mutexBus.Lock()
+	defer r.mutexBus.Unlock()
+
+	for t := range r.attachments {
+		if t != from {
+			_, _ = t.Write(frame)
+		}
+	}
+}
+
+// handle processes a frame seen on the bus
+func (r *Radio) handle(b []byte) {
+	f, err := civ.Parse(b)
+	if err != nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.silent || (f.To != r.address && f.To != civ.BroadcastAddress) {
+		return
+	}
+
+	event := fmt.Sprintf("command %02X % X", f.Command, f.Data)
+	if civ.HasSubcommand(f.Command) {
+		event = fmt.Sprintf("command %02X %02X % X", f.Command, f.Subcommand, f.Data)
+	}
+	defer func() {
+		if r.trace != nil {
+			r.trace(event)
+		}
+	}()
+
+	if r.collisions > 0 && f.To == r.address {
+		r.collisions--
+		event = "collision " + event
+		defer r.broadcast(nil, civ.CollisionFrame())
+		return
+	}
+
+	reply := r.reply(f.From, civ.NG)
+	switch f.Command {
+	case civ.CmdReadFrequency:
+		event = "read frequency"
+		reply = r.reply(f.From, civ.CmdReadFrequency, encodeFrequency(r.freq)...)
+
+	case civ.CmdSetFrequency:
+		freq, err := civ.DecodeFrequency(f.Data)
+		if err != nil {
+			break
+		}
+		r.freq = freq
+		event = fmt.Sprintf("set frequency %d", freq)
+		reply = r.reply(f.From, civ.OK)
+
+		// let transceive listeners know
+		defer r.broadcast(nil, r.reply(civ.BroadcastAddress, civ.CmdTransceiveFrequency, encodeFrequency(freq)...))
+
+	case civ.CmdReadMode:
+		event = "read mode"
+		reply = r.reply(f.From, civ.CmdReadMode, r.mode, r.filter)
+
+	case civ.CmdSetMode:
+		if len(f.Data) < 1 {
+			break
+		}
+		if _, ok := civ.ModeCode(civ.ModeName(f.Data[0])); !ok {
+			break
+		}
+		r.mode = f.Data[0]
+		if len(f.Data) > 1 {
+			r.filter = f.Data[1]
+		}
+		event = fmt.Sprintf("set mode %s", civ.ModeName(r.mode))
+		reply = r.reply(f.From, civ.OK)
+
+		// let transceive listeners know
+		defer r.broadcast(nil, r.reply(civ.BroadcastAddress, civ.CmdTransceiveMode, r.mode, r.filter))
+
+	case civ.CmdSettings:
+		if f.Subcommand != civ.SubSettingsData {
+			break
+		}
+
+		if len(f.Data) == 0 {
+			event = "read data mode"
+			dm := byte(0x00)
+			if r.dataMode {
+				dm = 0x01
+			}
+			reply = r.reply(f.From, civ.CmdSettings, civ.SubSettingsData, dm, r.filter)
+			break
+		}
+
+		r.dataMode = f.Data[0] != 0x00
+		event = fmt.Sprintf("set data mode %t", r.dataMode)
+		reply = r.reply(f.From, civ.OK)
+
+	case civ.CmdSplit:
+		if len(f.Data) == 0 {
+			event = "read split"
+			split := byte(0x00)
+			if r.split {
+				split = 0x01
+			}
+			reply = r.reply(f.From, civ.CmdSplit, split)
+			break
+		}
+
+		r.split = f.Data[0] == 0x01
+		event = fmt.Sprintf("set split %t", r.split)
+		reply = r.reply(f.From, civ.OK)
+
+	case civ.CmdVFOFrequency:
+		if len(f.Data) != 1 || (f.Data[0] != civ.VFOSelected && f.Data[0] != civ.VFOUnselected) {
+			break
+		}
+
+		freq := r.freq
+		event = "read selected vfo frequency"
+		if f.Data[0] == civ.VFOUnselected {
+			freq = r.unselected
+			event = "read unselected vfo frequency"
+		}
+		reply = r.reply(f.From, civ.CmdVFOFrequency, append([]byte{f.Data[0]}, encodeFrequency(freq)...)...)
+
+	case civ.CmdVFO:
+		if len(f.Data) != 1 || f.Data[0] != civ.VFOMainSubBand {
+			break
+		}
+
+		event = "read main/sub band"
+		sub := byte(0x00)
+		if r.subBand {
+			sub = 0x01
+		}
+		reply = r.reply(f.From, civ.CmdVFO, civ.VFOMainSubBand, sub)
+
+	case civ.CmdVarious:
+		if f.Subcommand == civ.SubVariousATU {
+			if r.noATU {
+				break
+			}
+
+			if len(f.Data) == 0 {
+				event = "read atu"
+				reply = r.reply(f.From, civ.CmdVarious, civ.SubVariousATU, r.atu)
+				break
+			}
+
+			if f.Data[0] > civ.ATUTune {
+				event = fmt.Sprintf("rejected atu % X", f.Data)
+				break
+			}
+
+			// a tune finishes straight away, leaving the tuner on
+			r.atu = f.Data[0]
+			if r.atu == civ.ATUTune {
+				r.atu = civ.ATUOn
+			}
+			event = fmt.Sprintf("set atu %t", r.atu != civ.ATUOff)
+			reply = r.reply(f.From, civ.OK)
+			break
+		}
+		if f.Subcommand != civ.SubVariousTX {
+			break
+		}
+
+		if len(f.Data) == 0 {
+			event = "read tx"
+			tx := byte(0x00)
+			if r.tx {
+				tx = 0x01
+			}
+			reply = r.reply(f.From, civ.CmdVarious, civ.SubVariousTX, tx)
+			break
+		}
+
+		r.tx = f.Data[0] != 0x00
+		event = fmt.Sprintf("set tx %t", r.tx)
+		reply = r.reply(f.From, civ.OK)
+
+	case civ.CmdLevel:
+		if f.Subcommand != civ.SubLevelRFPower {
+			break
+		}
+
+		if len(f.Data) == 0 {
+			event = "read rfpower"
+			level, _ := civ.EncodeLevel(r.rfPower)
+			reply = r.reply(f.From, civ.CmdLevel, append([]byte{civ.SubLevelRFPower}, level...)...)
+			break
+		}
+
+		level, err := civ.DecodeLevel(f.Data)
+		if err != nil || r.rejectPower {
+			event = fmt.Sprintf("rejected rfpower % X", f.Data)
+			break
+		}
+		if r.ignorePower {
+			event = fmt.Sprintf("ignored rfpower %d", level)
+		} else {
+			r.rfPower = level
+			event = fmt.Sprintf("set rfpower %d", level)
+		}
+		reply = r.reply(f.From, civ.OK)
+
+	case civ.CmdMeter:
+		value, ok := r.meter(f.Subcommand)
+		if !ok || len(f.Data) != 0 {
+			break
+		}
+
+		level, err := icom.MeterLevel(f.Subcommand, value)
+		if err != nil {
+			break
+		}
+		event = fmt.Sprintf("read meter %02X", f.Subcommand)
+		b, _ := civ.EncodeLevel(level)
+		reply = r.reply(f.From, civ.CmdMeter, append([]byte{f.Subcommand}, b...)...)
+	}
+
+	// replies are sent by the radio, so every attachment sees them
+	defer r.broadcast(nil, reply)
+}
+
+// meter returns what meter reads, rf output follows the RF power level & the PA draws more current with it
+// everything reads zero on receive, the mutex must be held
+func (r *Radio) meter(meter byte) (float64, bool) {
+	po := 0.0
+	if r.tx {
+		po = r.curve.Watts(r.rfPower) * 100 / r.curve.Max()
+	}
+
+	switch meter {
+	case civ.SubMeterPo:
+		return po, true
+	case civ.SubMeterSWR:
+		if !r.tx {
+			return 1.0, true
+		}
+		return r.swr, true
+	case civ.SubMeterALC:
+		return 0, true
+	case civ.SubMeterId:
+		if !r.tx {
+			return 0, true
+		}
+		return 2 + po*0.18, true
+	}
+
+	return 0, false
+}
+
+// reply builds a frame from the radio to address
+func (r *Radio) reply(to byte, cmd byte, data ...byte) []byte {
+	f := civ.Frame{
+		To:      to,
+		From:    r.address,
+		Command: cmd,
+	}
+	if civ.HasSubcommand(cmd) && len(data) > 0 {
+		f.Subcommand = data[0]
+		data = data[1:]
+	}
+	f.Data = data
+
+	return f.Bytes()
+}
+
+// encodeFrequency converts freq to the 5 BCD bytes an HF radio uses
+func encodeFrequency(freq int64) []byte {
+	b, err := civ.EncodeFrequency(freq, 5)
+	if err != nil {
+		return make([]byte, 5)
+	}
+
+	return b
+}
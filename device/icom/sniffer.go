@@ -0,0 +1,78 @@
+package icom
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bbathe/icom-powercombo-controller/device/icom/civ"
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+)
+
+// Sniffer records every frame seen on a CI-V connection to w, one capture line each, see civ.Capture
+type Sniffer struct {
+	mutex sync.Mutex
+	w     io.Writer
+
+	// only the first write error is logged, the bus is busy enough to fill the log otherwise
+	failed bool
+}
+
+// NewSniffer creates a sniffer writing capture lines to w
+func NewSniffer(w io.Writer) *Sniffer {
+	return &Sniffer{
+		w: w,
+	}
+}
+
+// Record writes raw, a frame sent by us (or read from the bus if sent is false), as a capture line
+func (s *Sniffer) Record(sent bool, raw []byte) {
+	if s == nil {
+		return
+	}
+
+	c := civ.Capture{
+		Time: time.Now(),
+		Sent: sent,
+		Raw:  append([]byte{}, raw...),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err := fmt.Fprintln(s.w, c)
+	if err != nil {
+		if !s.failed {
+			log.Printf("%+v", err)
+		}
+		s.failed = true
+		return
+	}
+	s.failed = false
+}
+
+// Sniff passively records everything on the bus p is connected to until p is closed or fails, nothing is sent
+func Sniff(p transport.Transport, s *Sniffer) error {
+	var msg []byte
+	buf := make([]byte, 64)
+
+	for {
+		n, err := p.Read(buf)
+		if err != nil {
+			if err == io.EOF || err == transport.ErrClosed {
+				return nil
+			}
+			return err
+		}
+
+		for _, c := range buf[:n] {
+			msg = append(msg, c)
+			if c == civ.Terminator {
+				s.Record(false, msg)
+				msg = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// pipeBuffer holds the bytes flowing in one direction of a pipe
+type pipeBuffer struct {
+	mutex  sync.Mutex
+	buf    []byte
+	closed bool
+	notify chan struct{}
+
+	// idle is true while the reader is waiting for bytes, drained is signaled when it becomes idle
+	idle    bool
+	drained *sync.Cond
+}
+
+func newPipeBuffer() *pipeBuffer {
+	pb := &pipeBuffer{notify: make(chan struct{}, 1)}
+	pb.drained = sync.NewCond(&pb.mutex)
+
+	return pb
+}
+
+func (pb *pipeBuffer) signal() {
+	select {
+	case pb.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (pb *pipeBuffer) write(b []byte) (int, error) {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	if pb.closed {
+		return 0, ErrClosed
+	}
+
+	pb.buf = append(pb.buf, b...)
+	pb.idle = false
+	pb.signal()
+
+	return len(b), nil
+}
+
+// writeAndWait writes b then waits until the reader has consumed everything and come back for more
+func (pb *pipeBuffer) writeAndWait(b []byte, timeout time.Duration) (int, error) {
+	n, err := pb.write(b)
+	if err != nil {
+		return n, err
+	}
+
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	expired := false
+	timer := time.AfterFunc(timeout, func() {
+		pb.mutex.Lock()
+		defer pb.mutex.Unlock()
+
+		expired = true
+		pb.drained.Broadcast()
+	})
+	defer timer.Stop()
+
+	for !pb.idle && !pb.closed && !expired {
+		pb.drained.Wait()
+	}
+
+	return n, nil
+}
+
+func (pb *pipeBuffer) read(b []byte, timeout time.Duration) (int, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		pb.mutex.Lock()
+		if len(pb.buf) > 0 {
+			n := copy(b, pb.buf)
+			pb.buf = pb.buf[n:]
+			pb.mutex.Unlock()
+			return n, nil
+		}
+		if pb.closed {
+			pb.mutex.Unlock()
+			return 0, io.EOF
+		}
+
+		// everything written so far has been handled
+		pb.idle = true
+		pb.drained.Broadcast()
+		pb.mutex.Unlock()
+
+		// wait for more bytes
+		select {
+		case <-pb.notify:
+		case <-timer.C:
+			return 0, nil
+		}
+	}
+}
+
+func (pb *pipeBuffer) close() {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	pb.closed = true
+	pb.signal()
+	pb.drained.Broadcast()
+}
+
+// pipeEnd is one side of an in-memory pipe
+type pipeEnd struct {
+	rx *pipeBuffer
+	tx *pipeBuffer
+
+	// wait for the other end to handle each write, like bytes going out on a wire
+	waitWrite bool
+
+	mutexTimeout sync.Mutex
+	timeout      time.Duration
+}
+
+// NewPipe creates an in-memory, buffered connection between a host and a device, bytes written to one end are read from the other
+// writes from the host end return once the device has read them and is waiting for more (or the write times out),
+// so commands sent to different devices are handled in the order they were sent
+func NewPipe() (Transport, Transport) {
+	a := newPipeBuffer()
+	b := newPipeBuffer()
+
+	return &pipeEnd{rx: a, tx: b, waitWrite: true, timeout: DefaultTimeout}, &pipeEnd{rx: b, tx: a, timeout: DefaultTimeout}
+}
+
+func (p *pipeEnd) Read(b []byte) (int, error) {
+	p.mutexTimeout.Lock()
+	t := p.timeout
+	p.mutexTimeout.Unlock()
+
+	return p.rx.read(b, t)
+}
+
+func (p *pipeEnd) Write(b []byte) (int, error) {
+	if p.waitWrite {
+		return p.tx.writeAndWait(b, DefaultTimeout)
+	}
+
+	return p.tx.write(b)
+}
+
+func (p *pipeEnd) SetReadTimeout(t time.Duration) error {
+	p.mutexTimeout.Lock()
+	defer p.mutexTimeout.Unlock()
+
+	p.timeout = t
+	return nil
+}
+
+func (p *pipeEnd) Close() error {
+	p.rx.close()
+	p.tx.close()
+	return nil
+}
+
+// PipeAcceptFunc is called with the device end of each pipe opened to a registered name
+type PipeAcceptFunc func(Transport)
+
+var (
+	mutexPipes sync.Mutex
+	pipes      = make(map[string]PipeAcceptFunc)
+)
+
+// RegisterPipe makes name available to OpenPipe, accept is handed the device end of every connection
+func RegisterPipe(name string, accept PipeAcceptFunc) {
+	mutexPipes.Lock()
+	defer mutexPipes.Unlock()
+
+	pipes[name] = accept
+}
+
+// UnregisterPipe removes name so it can no longer be opened
+func UnregisterPipe(name string) {
+	mutexPipes.Lock()
+	defer mutexPipes.Unlock()
+
+	delete(pipes, name)
+}
+
+// OpenPipe creates a connection to the pipe registered as name
+func OpenPipe(name string) (Transport, error) {
+	mutexPipes.Lock()
+	accept, ok := pipes[name]
+	mutexPipes.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no pipe registered as %q", name)
+	}
+
+	host, device := NewPipe()
+	go accept(device)
+
+	return host, nil
+}
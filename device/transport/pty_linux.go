@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+type ptyTransport struct {
+	f *os.File
+
+	mutexTimeout sync.Mutex
+	timeout      time.Duration
+}
+
+// OpenPTY creates a pseudo terminal, returns the controlling side and the name of the serial device for it
+// a device emulator serves on the controlling side and the driver opens the returned name like any serial port
+func OpenPTY() (Transport, string, error) {
+	f, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		log.Printf("%+v", err)
+		return nil, "", err
+	}
+
+	// unlock and find the name of the device side
+	err = unix.IoctlSetPointerInt(int(f.Fd()), unix.TIOCSPTLCK, 0)
+	if err != nil {
+		f.Close()
+		log.Printf("%+v", err)
+		return nil, "", err
+	}
+	n, err := unix.IoctlGetInt(int(f.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		f.Close()
+		log.Printf("%+v", err)
+		return nil, "", err
+	}
+
+	return &ptyTransport{f: f, timeout: DefaultTimeout}, fmt.Sprintf("/dev/pts/%d", n), nil
+}
+
+func (p *ptyTransport) Read(b []byte) (int, error) {
+	p.mutexTimeout.Lock()
+	timeout := p.timeout
+	p.mutexTimeout.Unlock()
+
+	err := p.f.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := p.f.Read(b)
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return n, nil
+		}
+
+		// nothing has the device side open, same as no bytes to read
+		if errors.Is(err, syscall.EIO) {
+			time.Sleep(timeout)
+			return 0, nil
+		}
+		return n, err
+	}
+
+	return n, nil
+}
+
+func (p *ptyTransport) Write(b []byte) (int, error) {
+	return p.f.Write(b)
+}
+
+func (p *ptyTransport) SetReadTimeout(t time.Duration) error {
+	p.mutexTimeout.Lock()
+	defer p.mutexTimeout.Unlock()
+
+	p.timeout = t
+	return nil
+}
+
+func (p *ptyTransport) Close() error {
+	return p.f.Close()
+}
@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"log"
+	"time"
+
+	"github.com/albenik/go-serial/v2"
+)
+
+type serialTransport struct {
+	p *serial.Port
+}
+
+// OpenSerial creates a connection over the serial port named port
+func OpenSerial(port string, baud int) (Transport, error) {
+	p, err := serial.Open(port,
+		serial.WithBaudrate(baud),
+		serial.WithReadTimeout(int(DefaultTimeout/time.Millisecond)),
+		serial.WithWriteTimeout(int(DefaultTimeout/time.Millisecond)),
+	)
+	if err != nil {
+		log.Printf("%+v", err)
+		return nil, err
+	}
+
+	return &serialTransport{p: p}, nil
+}
+
+func (s *serialTransport) Read(b []byte) (int, error) {
+	return s.p.Read(b)
+}
+
+func (s *serialTransport) Write(b []byte) (int, error) {
+	return s.p.Write(b)
+}
+
+func (s *serialTransport) SetReadTimeout(t time.Duration) error {
+	return s.p.SetReadTimeout(int(t / time.Millisecond))
+}
+
+func (s *serialTransport) Close() error {
+	return s.p.Close()
+}
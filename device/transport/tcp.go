@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+type tcpTransport struct {
+	c net.Conn
+
+	mutexTimeout sync.Mutex
+	timeout      time.Duration
+}
+
+// OpenTCP creates a connection to a network serial server (e.g. ser2net) at address host:port
+func OpenTCP(address string) (Transport, error) {
+	c, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		log.Printf("%+v", err)
+		return nil, err
+	}
+
+	return &tcpTransport{c: c, timeout: DefaultTimeout}, nil
+}
+
+func (t *tcpTransport) Read(b []byte) (int, error) {
+	t.mutexTimeout.Lock()
+	timeout := t.timeout
+	t.mutexTimeout.Unlock()
+
+	err := t.c.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := t.c.Read(b)
+	if err != nil {
+		// timeout is not an error, it's the same as a serial port with nothing to read
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return n, nil
+		}
+		return n, err
+	}
+
+	return n, nil
+}
+
+func (t *tcpTransport) Write(b []byte) (int, error) {
+	err := t.c.SetWriteDeadline(time.Now().Add(DefaultTimeout))
+	if err != nil {
+		return 0, err
+	}
+
+	return t.c.Write(b)
+}
+
+func (t *tcpTransport) SetReadTimeout(d time.Duration) error {
+	t.mutexTimeout.Lock()
+	defer t.mutexTimeout.Unlock()
+
+	t.timeout = d
+	return nil
+}
+
+func (t *tcpTransport) Close() error {
+	return t.c.Close()
+}
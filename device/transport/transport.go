@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Transport is a byte stream connection to a device
+type Transport interface {
+	// Read reads available bytes into b, returns 0 and no error if nothing arrived before the read timeout
+	Read(b []byte) (int, error)
+
+	// Write writes b to the device
+	Write(b []byte) (int, error)
+
+	// SetReadTimeout sets how long Read waits for bytes to arrive
+	SetReadTimeout(t time.Duration) error
+
+	// Close closes the connection to the device
+	Close() error
+}
+
+// kinds of transport that can be selected in config
+const (
+	KindSerial = "serial"
+	KindTCP    = "tcp"
+	KindPipe   = "pipe"
+)
+
+var (
+	// timeout used for reads & writes unless changed with SetReadTimeout
+	DefaultTimeout = 333 * time.Millisecond
+
+	ErrClosed = fmt.Errorf("transport closed")
+)
+
+// OpenFunc creates a connection to address for a kind of transport added with Register
+type OpenFunc func(address string, baud int) (Transport, error)
+
+var (
+	mutexKinds sync.Mutex
+	kinds      = make(map[string]OpenFunc)
+)
+
+// Register makes kind available to Open, for transports that live with the device that uses them
+func Register(kind string, open OpenFunc) {
+	mutexKinds.Lock()
+	defer mutexKinds.Unlock()
+
+	kinds[kind] = open
+}
+
+// Open creates a connection to address using the kind of transport requested
+// for serial the address is the port name, for tcp it is host:port and for pipe it is the registered pipe name
+func Open(kind string, address string, baud int) (Transport, error) {
+	switch kind {
+	case "", KindSerial:
+		return OpenSerial(address, baud)
+	case KindTCP:
+		return OpenTCP(address)
+	case KindPipe:
+		return OpenPipe(address)
+	}
+
+	mutexKinds.Lock()
+	open, ok := kinds[kind]
+	mutexKinds.Unlock()
+
+	if ok {
+		return open(address, baud)
+	}
+
+	return nil, fmt.Errorf("unknown transport %q", kind)
+}
@@ -0,0 +1,255 @@
+package scenario
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/bbathe/icom-powercombo-controller/config"
+	"github.com/bbathe/icom-powercombo-controller/controller"
+	"github.com/bbathe/icom-powercombo-controller/data"
+	"github.com/bbathe/icom-powercombo-controller/device/elecraft/sim"
+	"github.com/bbathe/icom-powercombo-controller/device/icom/lan"
+	icomsim "github.com/bbathe/icom-powercombo-controller/device/icom/sim"
+	"github.com/bbathe/icom-powercombo-controller/device/transport"
+	"github.com/bbathe/icom-powercombo-controller/status"
+)
+
+const (
+	pipeRadio  = "scenario-radio"
+	pipeKAT500 = "scenario-kat500"
+	pipeKPA500 = "scenario-kpa500"
+
+	radioAddress = 0x94
+
+	// login for the radio's network remote control stand-in
+	lanUsername = "scenario"
+	lanPassword = "secret"
+)
+
+// Rig is the simulated station a scenario runs against
+type Rig struct {
+	Radio  *icomsim.Radio
+	KAT500 *sim.KAT500
+	KPA500 *sim.KPA500
+
+	Controller *controller.Controller
+
+	// stand-in for the radio's network remote control, while it's in use
+	lan *lan.Server
+
+	mutexEvents sync.Mutex
+	events      []string
+
+	// device ends of the pipes the controller has open, by pipe name
+	mutexConns sync.Mutex
+	conns      map[string][]transport.Transport
+}
+
+// NewRig creates emulators for all devices and points the configuration at them
+func NewRig() *Rig {
+	r := &Rig{
+		Radio:  icomsim.NewRadio(radioAddress),
+		KAT500: sim.NewKAT500(),
+		KPA500: sim.NewKPA500(),
+		conns:  make(map[string][]transport.Transport),
+	}
+
+	// record everything the controller sends, in the order it arrives
+	r.Radio.SetTrace(func(event string) {
+		r.record("radio " + event)
+	})
+	r.KAT500.SetTrace(func(cmd string) {
+		r.record("kat500 " + cmd)
+	})
+	r.KPA500.SetTrace(func(cmd string) {
+		r.record("kpa500 " + cmd)
+	})
+
+	r.PlugIn("radio")
+	r.PlugIn("kat500")
+	r.PlugIn("kpa500")
+
+	// monitor & command ports share the one simulated ci-v bus, the emulator is at the IC-7300's default address
+	config.SetDefaults()
+	config.Radio = config.IcomRadio{
+		Transport:   transport.KindPipe,
+		MonitorPort: pipeRadio,
+		CommandPort: pipeRadio,
+		Model:       "IC-7300",
+	}
+	config.KAT500 = config.ElecraftKAT500{
+		Transport: transport.KindPipe,
+		Port:      pipeKAT500,
+	}
+	config.KPA500 = config.ElecraftKPA500{
+		Transport: transport.KindPipe,
+		Port:      pipeKPA500,
+	}
+
+	return r
+}
+
+// Start starts the controller against the emulators, with the KPA500 in standby like the UI does
+func (r *Rig) Start() error {
+	// forget anything left over from a previous run
+	data.KPA500{
+		Mode:    0,
+		Power:   0,
+		PAVolts: 0,
+		PAAmps:  0,
+	}.Update()
+	status.SetStatuses(status.StatusUnknown)
+
+	r.Controller = controller.NewController()
+
+	return r.Controller.SetKPA500Mode(0)
+}
+
+// Restart shuts down the controller and starts it again, sharing one connection to the radio for monitoring & commands if singlePort
+func (r *Rig) Restart(singlePort bool) error {
+	if r.Controller != nil {
+		r.Controller.Close()
+		r.Controller = nil
+	}
+
+	r.closeLAN()
+
+	config.Radio.Transport = transport.KindPipe
+	config.Radio.MonitorPort = pipeRadio
+	config.Radio.CommandPort = pipeRadio
+	if singlePort {
+		config.Radio.CommandPort = ""
+	}
+
+	return r.Start()
+}
+
+// RestartLAN shuts down the controller and starts it again connected to the radio over its network remote control,
+// logging in with password
+func (r *Rig) RestartLAN(password string) error {
+	if r.Controller != nil {
+		r.Controller.Close()
+		r.Controller = nil
+	}
+	r.closeLAN()
+
+	r.lan = lan.NewServer(lanUsername, lanPassword, func(t transport.Transport) {
+		r.mutexConns.Lock()
+		r.conns[pipeRadio] = append(r.conns[pipeRadio], t)
+		r.mutexConns.Unlock()
+
+		_ = r.Radio.Serve(t)
+	})
+
+	address, err := r.lan.Listen("127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+
+	// one login carries everything
+	config.Radio.Transport = lan.Kind
+	config.Radio.MonitorPort = lanUsername + ":" + password + "@" + address
+	config.Radio.CommandPort = ""
+
+	return r.Start()
+}
+
+// closeLAN stops the network remote control stand-in, if it's running
+func (r *Rig) closeLAN() {
+	if r.lan == nil {
+		return
+	}
+
+	_ = r.lan.Close()
+	r.lan = nil
+}
+
+// Stop shuts down the controller and removes the emulators
+func (r *Rig) Stop() {
+	if r.Controller != nil {
+		r.Controller.Close()
+		r.Controller = nil
+	}
+
+	r.closeLAN()
+	r.Unplug("radio")
+	r.Unplug("kat500")
+	r.Unplug("kpa500")
+}
+
+// PlugIn makes device available to the controller
+func (r *Rig) PlugIn(device string) {
+	switch device {
+	case "radio":
+		r.listen(pipeRadio, r.Radio.Serve)
+	case "kat500":
+		r.listen(pipeKAT500, r.KAT500.Serve)
+	case "kpa500":
+		r.listen(pipeKPA500, r.KPA500.Serve)
+	}
+}
+
+// Unplug drops every connection to device and stops new ones, like pulling the USB cable
+func (r *Rig) Unplug(device string) {
+	name := map[string]string{
+		"radio":  pipeRadio,
+		"kat500": pipeKAT500,
+		"kpa500": pipeKPA500,
+	}[device]
+
+	transport.UnregisterPipe(name)
+
+	r.mutexConns.Lock()
+	defer r.mutexConns.Unlock()
+
+	for _, t := range r.conns[name] {
+		_ = t.Close()
+	}
+	delete(r.conns, name)
+}
+
+// listen registers pipe name, keeping track of the connections so they can be unplugged
+func (r *Rig) listen(name string, serve func(transport.Transport) error) {
+	transport.RegisterPipe(name, func(t transport.Transport) {
+		r.mutexConns.Lock()
+		r.conns[name] = append(r.conns[name], t)
+		r.mutexConns.Unlock()
+
+		_ = serve(t)
+	})
+}
+
+func (r *Rig) record(event string) {
+	r.mutexEvents.Lock()
+	defer r.mutexEvents.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+// Events returns what the devices have received since the events were last cleared
+func (r *Rig) Events() []string {
+	r.mutexEvents.Lock()
+	defer r.mutexEvents.Unlock()
+
+	return append([]string{}, r.events...)
+}
+
+// ClearEvents forgets all recorded events
+func (r *Rig) ClearEvents() {
+	r.mutexEvents.Lock()
+	defer r.mutexEvents.Unlock()
+
+	r.events = nil
+}
+
+// indexOfEvent returns the position of the first event starting with prefix, ignoring case, -1 if there is none
+func indexOfEvent(events []string, prefix string) int {
+	prefix = strings.ToLower(prefix)
+	for i, e := range events {
+		if strings.HasPrefix(strings.ToLower(e), prefix) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,636 @@
+package scenario
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bbathe/icom-powercombo-controller/config"
+	"github.com/bbathe/icom-powercombo-controller/data"
+	"github.com/bbathe/icom-powercombo-controller/status"
+)
+
+var (
+	// how long an expectation has to become true
+	ExpectTimeout = 3 * time.Second
+
+	// how often an expectation is checked
+	pollInterval = 50 * time.Millisecond
+
+	// time between each step of spinning the vfo, about what a fast hand on the knob does
+	spinInterval = 20 * time.Millisecond
+)
+
+// step is one kind of line in a scenario script
+type step struct {
+	re *regexp.Regexp
+
+	// actions change the station, expectations are retried until they pass or time out
+	expectation bool
+
+	fn func(r *Rig, m []string) error
+}
+
+var steps = []step{
+	{re: regexp.MustCompile(`^(?:tune radio to|move to) ([0-9.]+) ?(mhz|khz|hz)$`), fn: stepTune},
+	{re: regexp.MustCompile(`^spin radio to ([0-9.]+) ?(mhz|khz|hz) in ([0-9.]+) ?(mhz|khz|hz) steps$`), fn: stepSpin},
+	{re: regexp.MustCompile(`^set vfo b to ([0-9.]+) ?(mhz|khz|hz)$`), fn: stepUnselected},
+	{re: regexp.MustCompile(`^split (on|off)$`), fn: stepSplit},
+	{re: regexp.MustCompile(`^select (main|sub) band$`), fn: stepSubBand},
+	{re: regexp.MustCompile(`^(try to )?switch to (operate|standby)$`), fn: stepSwitch},
+	{re: regexp.MustCompile(`^select mode ([a-z-]+?)(-d)?$`), fn: stepMode},
+	{re: regexp.MustCompile(`^set ([0-9]+)m (ssb|cw|data|amfm) rf power standby ([0-9.]+) operate ([0-9.]+)$`), fn: stepModeRFPower},
+	{re: regexp.MustCompile(`^calibrate ([0-9]+)m radio level ([0-9]+) at ([0-9.]+) ?w$`), fn: stepCalibrate},
+	{re: regexp.MustCompile(`^set ([0-9]+)m radio atu (on|off)$`), fn: stepBandATU},
+	{re: regexp.MustCompile(`^set ([0-9]+)m kat500 (segment|step) ([0-9]+) ?khz$`), fn: stepKAT500Tracking},
+	{re: regexp.MustCompile(`^radio atu (on|off)$`), fn: stepRadioATU},
+	{re: regexp.MustCompile(`^inject (kat500|kpa500) fault ([0-9]+)$`), fn: stepInjectFault},
+	{re: regexp.MustCompile(`^clear (kat500|kpa500) fault$`), fn: stepClearFault},
+	{re: regexp.MustCompile(`^(silence|restore) (radio|kat500|kpa500)$`), fn: stepSilence},
+	{re: regexp.MustCompile(`^(unplug|plug in) (radio|kat500|kpa500)$`), fn: stepPlug},
+	{re: regexp.MustCompile(`^(transmit|receive)$`), fn: stepTransmit},
+	{re: regexp.MustCompile(`^radio (accepts|ignores|rejects) rf power$`), fn: stepRadioRFPower},
+	{re: regexp.MustCompile(`^radio sees swr ([0-9.]+)$`), fn: stepRadioSWR},
+	{re: regexp.MustCompile(`^radio collides next ([0-9]+) commands?$`), fn: stepRadioCollisions},
+	{re: regexp.MustCompile(`^full tune$`), fn: stepFullTune},
+	{re: regexp.MustCompile(`^wait ([0-9.]+(?:ms|s))$`), fn: stepWait},
+	{re: regexp.MustCompile(`^use (one|two) ci-v ports?$`), fn: stepPorts},
+	{re: regexp.MustCompile(`^(try to )?use an? (ic-\S+)( with rf power in percent)?$`), fn: stepModel},
+	{re: regexp.MustCompile(`^use icom lan(?: with password (\S+))?$`), fn: stepLAN},
+
+	{re: regexp.MustCompile(`^expect (radio|kat500|kpa500) ([a-z]+) (\S+)$`), expectation: true, fn: expectDevice},
+	{re: regexp.MustCompile(`^expect data (radio|kat500|kpa500)\.([a-z]+) (\S+)$`), expectation: true, fn: expectData},
+	{re: regexp.MustCompile(`^expect status (radio|kat500|kpa500) (ok|failed|unknown)$`), expectation: true, fn: expectStatus},
+	{re: regexp.MustCompile(`^expect "([^"]+)" before "([^"]+)"$`), expectation: true, fn: expectOrder},
+	{re: regexp.MustCompile(`^expect no "([^"]+)"$`), fn: expectNoEvent},
+	{re: regexp.MustCompile(`^expect at most ([0-9]+) "([^"]+)"$`), fn: expectAtMost},
+}
+
+// RunFile runs the scenario script in file fname
+func RunFile(fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return Run(filepath.Base(fname), f)
+}
+
+// Run runs the scenario script read from rd against a new simulated station
+// each line is one step, blank lines and lines starting with # are ignored
+func Run(name string, rd io.Reader) error {
+	r := NewRig()
+	defer r.Stop()
+
+	err := r.Start()
+	if err != nil {
+		return fmt.Errorf("%s: start: %v", name, err)
+	}
+
+	scanner := bufio.NewScanner(rd)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.Join(strings.Fields(strings.ToLower(scanner.Text())), " ")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		err = runStep(r, line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", name, n, line, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// runStep finds the step for line and runs it
+func runStep(r *Rig, line string) error {
+	for _, s := range steps {
+		m := s.re.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		if !s.expectation {
+			return s.fn(r, m)
+		}
+
+		// give the controller time to catch up
+		deadline := time.Now().Add(ExpectTimeout)
+		for {
+			err := s.fn(r, m)
+			if err == nil || time.Now().After(deadline) {
+				return err
+			}
+			time.Sleep(pollInterval)
+		}
+	}
+
+	return fmt.Errorf("unknown step")
+}
+
+func stepTune(r *Rig, m []string) error {
+	f, err := parseFrequency(m[1], m[2])
+	if err != nil {
+		return err
+	}
+
+	r.ClearEvents()
+	r.Radio.SetFrequency(f)
+
+	return nil
+}
+
+// stepUnselected tunes the unselected vfo, where the radio transmits when split
+func stepUnselected(r *Rig, m []string) error {
+	f, err := parseFrequency(m[1], m[2])
+	if err != nil {
+		return err
+	}
+
+	r.ClearEvents()
+	r.Radio.SetUnselectedFrequency(f)
+
+	return nil
+}
+
+func stepSplit(r *Rig, m []string) error {
+	r.ClearEvents()
+	r.Radio.SetSplit(m[1] == "on")
+
+	return nil
+}
+
+// stepSubBand selects the main or sub band, on radios that have them
+func stepSubBand(r *Rig, m []string) error {
+	r.ClearEvents()
+	r.Radio.SetSubBand(m[1] == "sub")
+
+	return nil
+}
+
+// parseFrequency converts value in units (mhz, khz or hz) to Hz
+func parseFrequency(value string, units string) (int64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	switch units {
+	case "mhz":
+		f *= 1000000
+	case "khz":
+		f *= 1000
+	}
+
+	return int64(math.Round(f)), nil
+}
+
+// stepSpin spins the radio's vfo to a frequency, a transceive frame for every step like a tuning knob
+func stepSpin(r *Rig, m []string) error {
+	to, err := parseFrequency(m[1], m[2])
+	if err != nil {
+		return err
+	}
+	step, err := parseFrequency(m[3], m[4])
+	if err != nil {
+		return err
+	}
+	if step <= 0 {
+		return fmt.Errorf("step must be more than 0")
+	}
+
+	r.ClearEvents()
+
+	f := r.Radio.Frequency()
+	for f != to {
+		switch {
+		case to-f > step:
+			f += step
+		case f-to > step:
+			f -= step
+		default:
+			f = to
+		}
+
+		r.Radio.SetFrequency(f)
+		time.Sleep(spinInterval)
+	}
+
+	return nil
+}
+
+// stepSwitch switches the kpa500 mode, when trying a refusal is left for the expectations to check
+func stepSwitch(r *Rig, m []string) error {
+	mode := 0
+	if m[2] == "operate" {
+		mode = 1
+	}
+
+	r.ClearEvents()
+	err := r.Controller.SetKPA500Mode(mode)
+	if m[1] != "" {
+		return nil
+	}
+
+	return err
+}
+
+func stepMode(r *Rig, m []string) error {
+	r.ClearEvents()
+	return r.Radio.SetMode(strings.ToUpper(m[1]), m[2] != "")
+}
+
+// stepModeRFPower sets the radio rf power override for a band & mode group, it is used the next time rf power is set
+func stepModeRFPower(r *Rig, m []string) error {
+	band, _ := strconv.Atoi(m[1])
+	standby, _ := strconv.ParseFloat(m[3], 64)
+	operate, _ := strconv.ParseFloat(m[4], 64)
+
+	b, ok := config.Bands[band]
+	if !ok {
+		return fmt.Errorf("no %dm band", band)
+	}
+
+	modes := make(map[string]config.ModeRFPower)
+	for k, v := range b.RadioRFPower.Modes {
+		modes[k] = v
+	}
+	modes[m[2]] = config.ModeRFPower{Standby: standby, Operate: operate}
+	b.RadioRFPower.Modes = modes
+
+	config.Bands[band] = b
+
+	return nil
+}
+
+func stepInjectFault(r *Rig, m []string) error {
+	fault, err := strconv.Atoi(m[2])
+	if err != nil {
+		return err
+	}
+
+	r.ClearEvents()
+	if m[1] == "kat500" {
+		r.KAT500.InjectFault(fault)
+	} else {
+		r.KPA500.InjectFault(fault)
+	}
+
+	return nil
+}
+
+func stepClearFault(r *Rig, m []string) error {
+	r.ClearEvents()
+	if m[1] == "kat500" {
+		r.KAT500.ClearFault()
+	} else {
+		r.KPA500.ClearFault()
+	}
+
+	return nil
+}
+
+func stepSilence(r *Rig, m []string) error {
+	silent := (m[1] == "silence")
+
+	r.ClearEvents()
+	switch m[2] {
+	case "radio":
+		r.Radio.SetSilent(silent)
+	case "kat500":
+		r.KAT500.SetSilent(silent)
+	case "kpa500":
+		r.KPA500.SetSilent(silent)
+	}
+
+	return nil
+}
+
+func stepPlug(r *Rig, m []string) error {
+	r.ClearEvents()
+	if m[1] == "unplug" {
+		r.Unplug(m[2])
+	} else {
+		r.PlugIn(m[2])
+	}
+
+	return nil
+}
+
+func stepTransmit(r *Rig, m []string) error {
+	r.ClearEvents()
+
+	// radio drive follows its rf power level
+	r.KPA500.SetDrive(r.Radio.Output())
+	r.KPA500.SetTransmitting(m[1] == "transmit")
+	r.Radio.SetTransmitting(m[1] == "transmit")
+
+	return nil
+}
+
+// stepCalibrate adds a measured rf output to a band's radio calibration, it is used once the controller is restarted
+func stepCalibrate(r *Rig, m []string) error {
+	band, _ := strconv.Atoi(m[1])
+	level, _ := strconv.Atoi(m[2])
+	watts, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return err
+	}
+
+	if config.Radio.Calibration == nil {
+		config.Radio.Calibration = make(map[int]map[int]float64)
+	}
+	if config.Radio.Calibration[band] == nil {
+		config.Radio.Calibration[band] = make(map[int]float64)
+	}
+	config.Radio.Calibration[band][level] = watts
+
+	return nil
+}
+
+// stepKAT500Tracking sets how far the frequency has to move on a band before the kat500 is sent it
+func stepKAT500Tracking(r *Rig, m []string) error {
+	band, _ := strconv.Atoi(m[1])
+	khz, _ := strconv.ParseInt(m[3], 10, 64)
+
+	b, ok := config.Bands[band]
+	if !ok {
+		return fmt.Errorf("no %dm band", band)
+	}
+	if m[2] == "segment" {
+		b.KAT500Tracking.Segment = khz
+	} else {
+		b.KAT500Tracking.Step = khz
+	}
+	config.Bands[band] = b
+
+	return nil
+}
+
+// stepBandATU sets whether the radio's tuner is wanted on a band when the kpa500 is in standby
+func stepBandATU(r *Rig, m []string) error {
+	band, _ := strconv.Atoi(m[1])
+
+	b, ok := config.Bands[band]
+	if !ok {
+		return fmt.Errorf("no %dm band", band)
+	}
+	b.RadioATU = m[2] == "on"
+	config.Bands[band] = b
+
+	return nil
+}
+
+// stepRadioATU switches the radio's tuner from its front panel
+func stepRadioATU(r *Rig, m []string) error {
+	r.ClearEvents()
+	r.Radio.SetATU(m[1] == "on")
+
+	return nil
+}
+
+// stepRadioRFPower changes how the radio handles rf power writes
+func stepRadioRFPower(r *Rig, m []string) error {
+	r.ClearEvents()
+	r.Radio.SetIgnoreRFPower(m[1] == "ignores")
+	r.Radio.SetRejectRFPower(m[1] == "rejects")
+
+	return nil
+}
+
+// stepRadioSWR sets the swr the radio meters while transmitting
+func stepRadioSWR(r *Rig, m []string) error {
+	swr, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return err
+	}
+
+	r.ClearEvents()
+	r.Radio.SetSWR(swr)
+
+	return nil
+}
+
+// stepRadioCollisions makes the next commands to the radio collide on the bus
+func stepRadioCollisions(r *Rig, m []string) error {
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return err
+	}
+
+	r.ClearEvents()
+	r.Radio.SetCollisions(n)
+
+	return nil
+}
+
+func stepFullTune(r *Rig, m []string) error {
+	r.ClearEvents()
+	return r.Controller.KAT500FullTune()
+}
+
+func stepWait(r *Rig, m []string) error {
+	d, err := time.ParseDuration(m[1])
+	if err != nil {
+		return err
+	}
+
+	time.Sleep(d)
+	return nil
+}
+
+// stepPorts restarts the controller with separate monitor & command ports to the radio, or just the one
+func stepPorts(r *Rig, m []string) error {
+	r.ClearEvents()
+	return r.Restart(m[1] == "one")
+}
+
+// stepModel restarts the controller with the radio as another model, optionally from a configuration with rf power in
+// percent, "try to" is for one that can't be converted, the startup standby can't set the rf power
+func stepModel(r *Rig, m []string) error {
+	r.ClearEvents()
+
+	config.Radio.Model = strings.ToUpper(m[2])
+	config.Radio.Address = fmt.Sprintf("%02X", radioAddress)
+	if m[3] != "" {
+		config.Radio.RFPowerUnit = ""
+	}
+
+	err := r.Restart(false)
+	if m[1] != "" {
+		return nil
+	}
+	return err
+}
+
+// stepLAN restarts the controller connected to the radio over its network remote control, optionally logging in with the wrong password
+func stepLAN(r *Rig, m []string) error {
+	r.ClearEvents()
+
+	password := lanPassword
+	if m[1] != "" {
+		password = m[1]
+	}
+
+	return r.RestartLAN(password)
+}
+
+// expectDevice checks the state of an emulated device
+func expectDevice(r *Rig, m []string) error {
+	var got interface{}
+
+	switch m[1] + " " + m[2] {
+	case "radio frequency":
+		got = r.Radio.Frequency()
+	case "radio mode":
+		got = r.Radio.Mode()
+	case "radio rfpower":
+		got = r.Radio.RFPower()
+	case "radio atu":
+		got = r.Radio.ATU()
+	case "kat500 frequency":
+		got = r.KAT500.Frequency()
+	case "kat500 antenna":
+		got = r.KAT500.Antenna()
+	case "kat500 mode":
+		got = strings.ToLower(r.KAT500.Mode())
+	case "kat500 bypassed":
+		got = r.KAT500.Bypassed()
+	case "kat500 fault":
+		got = r.KAT500.Fault()
+	case "kat500 vswr":
+		got = r.KAT500.VSWR()
+	case "kpa500 mode":
+		got = r.KPA500.Mode()
+	case "kpa500 band":
+		got = r.KPA500.Band()
+	case "kpa500 fault":
+		got = r.KPA500.Fault()
+	case "kpa500 power":
+		got = math.Round(r.KPA500.Power())
+	default:
+		return fmt.Errorf("unknown property")
+	}
+
+	return compare(got, m[3])
+}
+
+// expectData checks a field of the shared data, e.g. radio.band
+func expectData(r *Rig, m []string) error {
+	d := reflect.ValueOf(data.GetData())
+
+	section := d.FieldByNameFunc(func(n string) bool {
+		return strings.EqualFold(n, m[1])
+	})
+	if !section.IsValid() {
+		return fmt.Errorf("unknown data %s", m[1])
+	}
+
+	field := section.FieldByNameFunc(func(n string) bool {
+		return strings.EqualFold(n, m[2])
+	})
+	if !field.IsValid() {
+		return fmt.Errorf("unknown data %s.%s", m[1], m[2])
+	}
+
+	return compare(field.Interface(), m[3])
+}
+
+func expectStatus(r *Rig, m []string) error {
+	t := map[string]status.SystemStatus{
+		"radio":  status.SystemStatusRadio,
+		"kat500": status.SystemStatusKAT500,
+		"kpa500": status.SystemStatusKPA500,
+	}[m[1]]
+
+	got := strings.ToLower(status.GetStatus(t).String())
+	if got != m[2] {
+		return fmt.Errorf("got %s", got)
+	}
+
+	return nil
+}
+
+// expectOrder checks that the first event starting with m[1] happened before the first starting with m[2]
+func expectOrder(r *Rig, m []string) error {
+	events := r.Events()
+
+	a := indexOfEvent(events, m[1])
+	b := indexOfEvent(events, m[2])
+	switch {
+	case a < 0:
+		return fmt.Errorf("no %q in %q", m[1], events)
+	case b < 0:
+		return fmt.Errorf("no %q in %q", m[2], events)
+	case a > b:
+		return fmt.Errorf("wrong order in %q", events)
+	}
+
+	return nil
+}
+
+// expectAtMost checks a command wasn't sent more than a number of times since the last action
+func expectAtMost(r *Rig, m []string) error {
+	n, _ := strconv.Atoi(m[1])
+
+	count := 0
+	for _, e := range r.Events() {
+		if indexOfEvent([]string{e}, m[2]) == 0 {
+			count++
+		}
+	}
+	if count > n {
+		return fmt.Errorf("sent %d times", count)
+	}
+
+	return nil
+}
+
+// expectNoEvent checks that no event starting with m[1] has happened since the last action
+func expectNoEvent(r *Rig, m []string) error {
+	events := r.Events()
+
+	if indexOfEvent(events, m[1]) >= 0 {
+		return fmt.Errorf("found in %q", events)
+	}
+
+	return nil
+}
+
+// compare checks got against the scenario value want
+func compare(got interface{}, want string) error {
+	switch want {
+	case "operate":
+		want = "1"
+	case "standby":
+		want = "0"
+	case "on":
+		want = "true"
+	case "off":
+		want = "false"
+	}
+
+	g := fmt.Sprint(got)
+	if strings.EqualFold(g, want) {
+		return nil
+	}
+
+	// numbers only need to be close
+	gf, err1 := strconv.ParseFloat(g, 64)
+	wf, err2 := strconv.ParseFloat(want, 64)
+	if err1 == nil && err2 == nil && math.Abs(gf-wf) < 0.005 {
+		return nil
+	}
+
+	return fmt.Errorf("got %s", g)
+}
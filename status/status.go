@@ -68,6 +68,18 @@ func SetStatus(t SystemStatus, s StatusValue) {
 	}
 }
 
+// GetStatus returns the current status of t
+func GetStatus(t SystemStatus) StatusValue {
+	mutexStatuses.Lock()
+	defer mutexStatuses.Unlock()
+
+	if t < SystemStatusLast {
+		return statuses[t]
+	}
+
+	return StatusUnknown
+}
+
 func SetStatuses(s StatusValue) {
 	mutexStatuses.Lock()
 	defer mutexStatuses.Unlock()
@@ -78,3 +90,29 @@ func SetStatuses(s StatusValue) {
 	}
 	publishTaskStatusChange()
 }
+
+// String returns the display name of the status item
+func (t SystemStatus) String() string {
+	switch t {
+	case SystemStatusRadio:
+		return "Radio"
+	case SystemStatusKAT500:
+		return "KAT500"
+	case SystemStatusKPA500:
+		return "KPA500"
+	}
+
+	return "Unknown"
+}
+
+// String returns the display name of the status value
+func (s StatusValue) String() string {
+	switch s {
+	case StatusOK:
+		return "OK"
+	case StatusFailed:
+		return "Failed"
+	}
+
+	return "Unknown"
+}
@@ -1,3 +1,6 @@
+//go:build windows
+// +build windows
+
 package ui
 
 import (
@@ -20,9 +23,27 @@ import (
 	"golang.org/x/sys/windows"
 )
 
+// mainwinposition is the top left of the main window, persisted with the configuration
+type mainwinposition struct {
+	X int `yaml:"topleftx"`
+	Y int `yaml:"toplefty"`
+}
+
+// settings is what the ui keeps in the configuration file
+type settings struct {
+	MainWinPosition mainwinposition
+}
+
 var (
 	mainWin *walk.MainWindow
 
+	uiSettings = settings{
+		MainWinPosition: mainwinposition{
+			X: 200,
+			Y: 200,
+		},
+	}
+
 	appName     = "icom-powercombo-controller"
 	appIcon     *walk.Icon
 	fontBold    *walk.Font
@@ -39,6 +60,9 @@ var (
 func init() {
 	var err error
 
+	// persist our settings with the configuration
+	config.UI = &uiSettings
+
 	// load app icon
 	appIcon, err = walk.Resources.Icon("2")
 	if err != nil {
@@ -297,13 +321,13 @@ func MainWindow() error {
 	}
 
 	// set window position based on config
-	err = mainWin.SetY(config.UI.MainWinPosition.Y)
+	err = mainWin.SetY(uiSettings.MainWinPosition.Y)
 	if err != nil {
 		MsgError(nil, err)
 		log.Printf("%+v", err)
 		return err
 	}
-	err = mainWin.SetX(config.UI.MainWinPosition.X)
+	err = mainWin.SetX(uiSettings.MainWinPosition.X)
 	if err != nil {
 		MsgError(nil, err)
 		log.Printf("%+v", err)
@@ -324,7 +348,7 @@ func MainWindow() error {
 			status.Detach(hStatusChangeEventHandler)
 
 			// save windows position in config
-			config.UI.MainWinPosition.FromBounds(mainWin.Bounds())
+			saveMainWinPosition(mainWin.Bounds())
 			err = config.Write(configFile)
 			if err != nil {
 				MsgError(nil, err)
@@ -429,6 +453,12 @@ func determineConfigFile() (string, error) {
 	return configFile, nil
 }
 
+// saveMainWinPosition records the top left of the main window in our settings
+func saveMainWinPosition(bounds walk.Rectangle) {
+	uiSettings.MainWinPosition.X = bounds.X
+	uiSettings.MainWinPosition.Y = bounds.Y
+}
+
 // resetMainWinSize resets the windows height & width
 func resetMainWinSize(w *walk.MainWindow) error {
 	err := w.SetWidth(180)
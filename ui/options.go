@@ -1,3 +1,6 @@
+//go:build windows
+// +build windows
+
 package ui
 
 import (
@@ -6,8 +9,10 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/bbathe/icom-powercombo-controller/config"
+	"github.com/bbathe/icom-powercombo-controller/device/icom"
 	"github.com/lxn/walk"
 	"go.bug.st/serial"
 
@@ -133,9 +138,12 @@ func optionsWindow(parent *walk.MainWindow, cfn string) error {
 									Low:  config.Bands[k].Low,
 									High: config.Bands[k].High,
 									RadioRFPower: config.RadioRFPower{
-										Standby: int(neBands[i][0].Value()),
-										Operate: int(neBands[i][1].Value()),
+										Standby: neBands[i][0].Value(),
+										Operate: neBands[i][1].Value(),
+										Modes:   config.Bands[k].RadioRFPower.Modes,
 									},
+									RadioATU:       config.Bands[k].RadioATU,
+									KAT500Tracking: config.Bands[k].KAT500Tracking,
 								}
 							}
 
@@ -167,14 +175,14 @@ func optionsWindow(parent *walk.MainWindow, cfn string) error {
 
 	// initialize control values to what's in config
 	for i, k := range keysBands {
-		err = neBands[i][0].SetValue(float64(config.Bands[k].RadioRFPower.Standby))
+		err = neBands[i][0].SetValue(config.Bands[k].RadioRFPower.Standby)
 		if err != nil {
 			MsgError(parent, err)
 			log.Printf("%+v", err)
 			return err
 		}
 
-		err = neBands[i][1].SetValue(float64(config.Bands[k].RadioRFPower.Operate))
+		err = neBands[i][1].SetValue(config.Bands[k].RadioRFPower.Operate)
 		if err != nil {
 			MsgError(parent, err)
 			log.Printf("%+v", err)
@@ -189,11 +197,24 @@ func optionsWindow(parent *walk.MainWindow, cfn string) error {
 }
 
 func tabConfigRadio() declarative.TabPage {
+	var cbModel *walk.ComboBox
 	var cbMonitorPort *walk.ComboBox
 	var cbCommandPort *walk.ComboBox
 	var neBaud *walk.NumberEdit
 	var leAddress *walk.LineEdit
 
+	// command port can be left empty to share the monitor port
+	commandPorts := append([]string{""}, ports...)
+
+	// find current model, empty if it isn't one we know
+	models := append([]string{""}, icom.ModelNames()...)
+	var nModel int
+	for n := 0; n < len(models); n++ {
+		if strings.EqualFold(models[n], radioConfig.Model) {
+			nModel = n
+		}
+	}
+
 	// find current ports
 	var nMonitorPort int
 	var nCommandPort int
@@ -201,16 +222,15 @@ func tabConfigRadio() declarative.TabPage {
 		if ports[n] == radioConfig.MonitorPort {
 			nMonitorPort = n
 		}
-		if ports[n] == radioConfig.CommandPort {
+	}
+	for n := 0; n < len(commandPorts); n++ {
+		if commandPorts[n] == radioConfig.CommandPort {
 			nCommandPort = n
 		}
 	}
 	if nMonitorPort == len(ports) {
 		nMonitorPort = 0
 	}
-	if nCommandPort == len(ports) {
-		nCommandPort = 0
-	}
 
 	tp := declarative.TabPage{
 		Title:  "Radio",
@@ -223,6 +243,32 @@ func tabConfigRadio() declarative.TabPage {
 			declarative.Composite{
 				Layout: declarative.VBox{},
 				Children: []declarative.Widget{
+					declarative.Composite{
+						Layout: declarative.HBox{MarginsZero: true},
+						Children: []declarative.Widget{
+							declarative.HSpacer{},
+							declarative.Label{
+								Text:    "Model",
+								MinSize: declarative.Size{Width: 100},
+							},
+							declarative.ComboBox{
+								AssignTo:     &cbModel,
+								Model:        models,
+								CurrentIndex: nModel,
+								MinSize:      declarative.Size{Width: 75},
+								OnCurrentIndexChanged: func() {
+									radioConfig.Model = models[cbModel.CurrentIndex()]
+
+									// start from the model's default address
+									a := icom.DefaultAddress(radioConfig.Model, "")
+									if a != "" && leAddress != nil {
+										_ = leAddress.SetText(a)
+									}
+								},
+							},
+							declarative.HSpacer{},
+						},
+					},
 					declarative.Composite{
 						Layout: declarative.HBox{MarginsZero: true},
 						Children: []declarative.Widget{
@@ -253,11 +299,11 @@ func tabConfigRadio() declarative.TabPage {
 							},
 							declarative.ComboBox{
 								AssignTo:     &cbCommandPort,
-								Model:        ports,
+								Model:        commandPorts,
 								CurrentIndex: nCommandPort,
 								MinSize:      declarative.Size{Width: 75},
 								OnCurrentIndexChanged: func() {
-									radioConfig.CommandPort = ports[cbCommandPort.CurrentIndex()]
+									radioConfig.CommandPort = commandPorts[cbCommandPort.CurrentIndex()]
 								},
 							},
 							declarative.HSpacer{},
@@ -320,6 +366,13 @@ func tabConfigBandPower() declarative.TabPage {
 		Children: []declarative.Widget{},
 	}
 
+	// up to what the configured model can put out
+	maxWatts := 200.0
+	m, err := icom.LookupModel(config.Radio.Model)
+	if err == nil {
+		maxWatts = float64(m.MaxPower)
+	}
+
 	// dynamically build band power controls
 	tp.Children = make([]declarative.Widget, len(config.Bands)+1)
 
@@ -371,11 +424,11 @@ func tabConfigBandPower() declarative.TabPage {
 				declarative.NumberEdit{
 					AssignTo:           &neBands[bnum][0],
 					MinSize:            declarative.Size{Width: 75},
-					Decimals:           0,
+					Decimals:           1,
 					MinValue:           0,
-					MaxValue:           100,
+					MaxValue:           maxWatts,
 					SpinButtonsVisible: true,
-					Suffix:             "%",
+					Suffix:             " W",
 				},
 				declarative.HSpacer{
 					MinSize: declarative.Size{Width: 45},
@@ -384,11 +437,11 @@ func tabConfigBandPower() declarative.TabPage {
 				declarative.NumberEdit{
 					AssignTo:           &neBands[bnum][1],
 					MinSize:            declarative.Size{Width: 75},
-					Decimals:           0,
+					Decimals:           1,
 					MinValue:           0,
-					MaxValue:           100,
+					MaxValue:           maxWatts,
 					SpinButtonsVisible: true,
-					Suffix:             "%",
+					Suffix:             " W",
 				},
 				declarative.HSpacer{
 					MinSize: declarative.Size{Width: 30},
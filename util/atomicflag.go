@@ -25,3 +25,15 @@ func (b *AtomFlag) IsTrue() bool {
 func (b *AtomFlag) IsFalse() bool {
 	return atomic.LoadInt32(&(b.flag)) == 0
 }
+
+// CompareAndSet sets the flag to value if it is currently old, returns whether it was set
+func (b *AtomFlag) CompareAndSet(old bool, value bool) bool {
+	var o, v int32 = 0, 0
+	if old {
+		o = 1
+	}
+	if value {
+		v = 1
+	}
+	return atomic.CompareAndSwapInt32(&(b.flag), o, v)
+}
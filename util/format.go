@@ -17,3 +17,21 @@ func BandFromFrequency(freq int64) (int, error) {
 
 	return 0, fmt.Errorf("out of band")
 }
+
+// ModeGroup returns the config mode group for the radio mode, data is true if the radio's data mode is on
+func ModeGroup(mode string, data bool) string {
+	if data {
+		return config.ModeGroupData
+	}
+
+	switch mode {
+	case "CW", "CW-R":
+		return config.ModeGroupCW
+	case "RTTY", "RTTY-R":
+		return config.ModeGroupData
+	case "AM", "FM", "WFM":
+		return config.ModeGroupAMFM
+	}
+
+	return config.ModeGroupSSB
+}
@@ -0,0 +1,115 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is an append only log file that is moved aside once it gets to MaxSize bytes,
+// name becomes name.1, name.1 becomes name.2 and so on, keeping Backups old files
+type RotatingFile struct {
+	Name    string
+	MaxSize int64
+	Backups int
+
+	mutex sync.Mutex
+	f     *os.File
+	size  int64
+}
+
+// NewRotatingFile creates a RotatingFile for name, the file isn't opened until the first write
+func NewRotatingFile(name string, maxSize int64, backups int) *RotatingFile {
+	return &RotatingFile{
+		Name:    name,
+		MaxSize: maxSize,
+		Backups: backups,
+	}
+}
+
+// Write appends b to the file, rotating it first if b would take it over MaxSize
+func (rf *RotatingFile) Write(b []byte) (int, error) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	// opening learns how big the file already is, it may be over MaxSize from before
+	if rf.f == nil {
+		err := rf.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if rf.size > 0 && rf.size+int64(len(b)) > rf.MaxSize {
+		err := rf.rotate()
+		if err != nil {
+			return 0, err
+		}
+
+		err = rf.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(b)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the file, the next write opens it again
+func (rf *RotatingFile) Close() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.f == nil {
+		return nil
+	}
+
+	err := rf.f.Close()
+	rf.f = nil
+
+	return err
+}
+
+// open opens the file for appending, the mutex must be held
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.Name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.f = f
+	rf.size = fi.Size()
+
+	return nil
+}
+
+// rotate closes the file and shifts it & the backups along, dropping the oldest, the mutex must be held
+func (rf *RotatingFile) rotate() error {
+	err := rf.f.Close()
+	rf.f = nil
+	if err != nil {
+		return err
+	}
+
+	if rf.Backups < 1 {
+		return os.Remove(rf.Name)
+	}
+
+	for i := rf.Backups - 1; i > 0; i-- {
+		err = os.Rename(fmt.Sprintf("%s.%d", rf.Name, i), fmt.Sprintf("%s.%d", rf.Name, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(rf.Name, rf.Name+".1")
+}